@@ -0,0 +1,179 @@
+package mandelbrot
+
+import (
+	"context"
+	"image/color"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync/atomic"
+)
+
+const (
+	// buddhaBatch is the number of samples per job. Each job draws from its
+	// own random stream, so the result only depends on the seed.
+	buddhaBatch = 4096
+	// DefaultSamples is the default number of Buddhabrot samples per pixel.
+	DefaultSamples = 20
+)
+
+// buddhaPasses are the fractions of all samples added by each pass of a
+// progressive Buddhabrot render.
+var buddhaPasses = []float64{1.0 / 8, 1.0 / 8, 1.0 / 4, 1.0 / 2}
+
+// Sampling region of c, which holds every orbit that stays bounded for long
+var (
+	sampleMin = complex(-2.0, -1.5)
+	sampleMax = complex(1.0, 1.5)
+)
+
+// isDensity reports whether fractal is rendered as orbit density rather than
+// escape time.
+func isDensity(fractal int) bool {
+	return fractal == FractalBuddhabrot || fractal == FractalNebulabrot
+}
+
+// densityLimits returns the iteration limit of each channel: one for the
+// Buddhabrot, and red, green and blue for the Nebulabrot.
+func densityLimits(params MandelbrotParams) []int {
+	if params.Fractal == FractalNebulabrot {
+		return []int{params.MaxIter, max(params.MaxIter/10, 5), max(params.MaxIter/100, 5)}
+	}
+	return []int{params.MaxIter}
+}
+
+// densityJobs returns the number of sample batches of a width x height target.
+func densityJobs(params MandelbrotParams, width, height int) int {
+	samples := max(params.Samples, 1) * width * height
+	return (samples + buddhaBatch - 1) / buddhaBatch
+}
+
+// densityRenderer accumulates escaping orbits into a field.
+type densityRenderer struct {
+	params           MandelbrotParams
+	field            *IterField
+	limits           []int
+	maxIter          int
+	left, top        float64 // complex coordinates of the top-left corner
+	deltaRe, deltaIm float64
+}
+
+func newDensityRenderer(params MandelbrotParams, width, height int) *densityRenderer {
+	v := newViewport(params, width, height)
+	limits := densityLimits(params)
+	field := &IterField{
+		Width:    width,
+		Height:   height,
+		MaxIter:  params.MaxIter,
+		Fractal:  params.Fractal,
+		Channels: len(limits),
+		Density:  make([]uint32, width*height*len(limits)),
+	}
+	return &densityRenderer{
+		params:  params,
+		field:   field,
+		limits:  limits,
+		maxIter: slices.Max(limits),
+		left:    v.re + v.minRe,
+		top:     v.im + v.minIm,
+		deltaRe: v.deltaRe,
+		deltaIm: v.deltaIm,
+	}
+}
+
+// run adds the samples of jobs [from, to).
+func (r *densityRenderer) run(ctx context.Context, from, to int) error {
+	return runJobs(ctx, to-from, r.params.Workers, func(job int) {
+		rng := rand.New(rand.NewPCG(uint64(r.params.Seed), uint64(from+job)))
+		for range buddhaBatch {
+			c := complex(
+				real(sampleMin)+rng.Float64()*real(sampleMax-sampleMin),
+				imag(sampleMin)+rng.Float64()*imag(sampleMax-sampleMin))
+			r.sample(c)
+		}
+	})
+}
+
+// sample records the orbit of c if it escapes. Bounded orbits are found
+// cheaply first, so only escaping orbits are iterated twice.
+func (r *densityRenderer) sample(c complex128) {
+	p, _ := mandelbrot(c, r.maxIter, false)
+	if !p.Escaped {
+		return
+	}
+	width, height := r.field.Width, r.field.Height
+	z := complex128(0)
+	for range p.Iter {
+		z = z*z + c
+		fx := (real(z) - r.left) / r.deltaRe
+		fy := (imag(z) - r.top) / r.deltaIm
+		if fx < 0 || fy < 0 || fx >= float64(width) || fy >= float64(height) {
+			continue
+		}
+		x, y := int(fx), int(fy)
+		i := (y*width + x) * r.field.Channels
+		for ch, limit := range r.limits {
+			if p.Iter < limit {
+				atomic.AddUint32(&r.field.Density[i+ch], 1)
+			}
+		}
+	}
+}
+
+// snapshot returns a copy of the field accumulated so far, with its peaks.
+func (r *densityRenderer) snapshot() *IterField {
+	field := *r.field
+	field.Density = append([]uint32(nil), r.field.Density...)
+	field.Peak = make([]uint32, field.Channels)
+	for i, n := range field.Density {
+		ch := i % field.Channels
+		field.Peak[ch] = max(field.Peak[ch], n)
+	}
+	return &field
+}
+
+// renderDensity renders the Buddhabrot or Nebulabrot of params, yielding the
+// field after each pass of buddhaPasses when progressive is set.
+func renderDensity(ctx context.Context, params MandelbrotParams, width, height int, progressive bool, yield func(*IterField) error) error {
+	r := newDensityRenderer(params, width, height)
+	jobs := densityJobs(params, width, height)
+	if !progressive {
+		if err := r.run(ctx, 0, jobs); err != nil {
+			return err
+		}
+		return yield(r.snapshot())
+	}
+
+	from, done := 0, 0.0
+	for _, fraction := range buddhaPasses {
+		done += fraction
+		to := int(math.Round(done * float64(jobs)))
+		if err := r.run(ctx, from, to); err != nil {
+			return err
+		}
+		from = to
+		if err := yield(r.snapshot()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// densityColor tone-maps the orbit density at pixel i of field. A single
+// channel is colored with the scheme, three channels are used as RGB.
+func densityColor(colors ColorParams, field *IterField, i int) color.Color {
+	tone := func(ch int) float64 {
+		if field.Peak[ch] == 0 {
+			return 0
+		}
+		return math.Sqrt(float64(field.Density[i*field.Channels+ch]) / float64(field.Peak[ch]))
+	}
+	if field.Channels == 3 {
+		// Without a scheme, the density brightens the channels instead
+		gain := func(ch int) uint8 {
+			return uint8(255 * math.Min(1, tone(ch)*colors.ColorDensity))
+		}
+		return color.RGBA{gain(0), gain(1), gain(2), 255}
+	}
+	return colors.scheme(tone(0))
+}
@@ -1,7 +1,9 @@
 package mandelbrot
 
 import (
+	"context"
 	"fmt"
+	"image"
 	"image/color"
 	"math"
 )
@@ -21,50 +23,32 @@ const (
 	ColorModeCount
 )
 
-var ColorNames = map[int]string{
-	ColorGrayscale:   "Grayscale",
-	ColorRainbow:     "Rainbow",
-	ColorFire:        "Fire",
-	ColorPsychedelic: "Psychedelic",
-	ColorOcean:       "Ocean",
-	ColorIce:         "Ice",
-	ColorInferno:     "Inferno",
-	ColorDesert:      "Desert",
-	ColorNebula:      "Nebula",
-	ColorForest:      "Forest",
-}
-
-// hsvToRGBA converts HSV values (h in [0,360], s,v in [0,1]) to color.RGBA
-func hsvToRGBA(h float64, s float64, v float64) color.Color {
-	c := v * s
-	x := c * (1 - math.Abs(math.Mod(h/60.0, 2)-1))
-	m := v - c
-
-	var r, g, b float64
+// Constants for coloring algorithms
+const (
+	ColoringIteration = iota // Escape iteration, optionally smoothed
+	ColoringDistance         // Distance estimate, in pixels
+	ColoringHistogram        // Escape iteration, equalized over the frame
+	ColoringOrbitTrap        // Closest approach of the orbit to a shape
+	ColoringStripe           // Stripe average of the angle of the orbit
+	ColoringTriangle         // Triangle inequality average
+	ColoringCount
+)
 
-	switch {
-	case h >= 0 && h < 60:
-		r, g, b = c, x, 0
-	case h >= 60 && h < 120:
-		r, g, b = x, c, 0
-	case h >= 120 && h < 180:
-		r, g, b = 0, c, x
-	case h >= 180 && h < 240:
-		r, g, b = 0, x, c
-	case h >= 240 && h < 300:
-		r, g, b = x, 0, c
-	case h >= 300 && h < 360:
-		r, g, b = c, 0, x
-	default:
-		r, g, b = 0, 0, 0
-	}
+var ColoringNames = map[int]string{
+	ColoringIteration: "Iteration",
+	ColoringDistance:  "Distance",
+	ColoringHistogram: "Histogram",
+	ColoringOrbitTrap: "Orbit trap",
+	ColoringStripe:    "Stripe average",
+	ColoringTriangle:  "Triangle average",
+}
 
-	r = (r + m) * 255
-	g = (g + m) * 255
-	b = (b + m) * 255
+// distanceOctaves is the number of doublings of the distance, in pixels,
+// that the palette spans in distance coloring.
+const distanceOctaves = 8
 
-	return color.RGBA{uint8(r), uint8(g), uint8(b), 255}
-}
+// ColorNames names the color schemes, filled in by RegisterPalette.
+var ColorNames = map[int]string{}
 
 // getColorString returns a string that colors a 2-space block using 24-bit RGB ANSI escape codes
 func getColorString(color color.Color) string {
@@ -72,59 +56,128 @@ func getColorString(color color.Color) string {
 	return fmt.Sprintf("\033[48;2;%d;%d;%dm  \033[0m", r, g, b)
 }
 
-// getColor returns a color.Color for a given iteration count and color scheme.
-func getColor(scheme int, iterations float64, maxIter int) color.Color {
-	if int(iterations) == maxIter {
+// getColor returns the color of a single point under the given coloring settings.
+func getColor(colors ColorParams, p Point, field *IterField) color.Color {
+	if !p.Escaped {
 		return color.RGBA{0, 0, 0, 255}
 	}
 
 	// Normalize t to avoid extreme values
-	t := math.Max(0, math.Min(1.0, iterations/float64(maxIter)))
-
-	switch scheme {
-	case ColorRainbow: // Rainbow
-		hue := 360.0 * t
-		return hsvToRGBA(hue, 1.0, 1.0)
-	case ColorFire: // Fire
-		r := math.Min(1.0, t*3)
-		g := math.Max(0, math.Min(1.0, t*3-1))
-		b := math.Max(0, math.Min(1.0, t*3-2))
-		return color.RGBA{uint8(r * 255), uint8(g * 255), uint8(b * 255), 255}
-	case ColorOcean: // Ocean
-		r := math.Max(0, math.Min(1.0, t*3-2))
-		g := math.Max(0, math.Min(1.0, t*2-1))
-		b := math.Min(1.0, t+0.2)
-		return color.RGBA{uint8(r * 255), uint8(g * 255), uint8(b * 255), 255}
-	case ColorPsychedelic:
-		hue := math.Mod(t*360*5, 360) // cycle hue rapidly
-		return hsvToRGBA(hue, 1.0, 1.0)
-	case ColorIce:
-		r := uint8(0)
-		g := uint8(t * 200)
-		b := uint8(100 + t*155)
-		return color.RGBA{r, g, b, 255}
-	case ColorInferno:
-		r := uint8(math.Min(1.0, t*4) * 255)
-		g := uint8(math.Pow(t, 1.5) * 100)
-		b := uint8(math.Pow(1-t, 3) * 255)
-		return color.RGBA{r, g, b, 255}
-	case ColorDesert:
-		r := uint8(255 * t)
-		g := uint8(200 * (1 - t))
-		b := uint8(100 + 100*t)
-		return color.RGBA{r, g, b, 255}
-	case ColorNebula:
-		hue := 240 + 120*math.Sin(t*4*math.Pi)
-		return hsvToRGBA(hue, 0.6+0.4*t, 0.8)
-	case ColorForest:
-		r := uint8(30 + 50*(1-t))
-		g := uint8(100 + 155*t)
-		b := uint8(30 + 20*t)
-		return color.RGBA{r, g, b, 255}
-
-	default: // Grayscale
-		brightness := 1.0 - t
-		gray := uint8(brightness * 255)
-		return color.RGBA{gray, gray, gray, 255}
+	t := math.Max(0, math.Min(1.0, p.smoothIter(field, colors.Smooth)/float64(field.MaxIter)))
+	return colors.scheme(t)
+}
+
+// fieldColorer colors the pixels of a field. Coloring that depends on the
+// whole field, like the iteration histogram, is computed once up front.
+type fieldColorer struct {
+	colors ColorParams
+	field  *IterField
+	cdf    []float64 // Cumulative iteration histogram, for histogram coloring
+}
+
+func newFieldColorer(colors ColorParams, field *IterField) fieldColorer {
+	c := fieldColorer{colors: colors, field: field}
+	if colors.Coloring == ColoringHistogram && field.Density == nil {
+		c.cdf = iterationCDF(field)
+	}
+	return c
+}
+
+// at returns the color of pixel (x, y); the field decides how its pixels
+// are colored.
+func (c fieldColorer) at(x, y int) color.Color {
+	colors, field := c.colors, c.field
+	switch {
+	case field.Density != nil:
+		return densityColor(colors, field, y*field.Width+x)
+	case field.Roots > 0:
+		return newtonColor(colors, field.At(x, y), field.Roots)
+	case field.Fractal == FractalLyapunov:
+		return lyapunovColor(colors, field.At(x, y))
+	case field.Fractal == FractalMandelbulb:
+		return bulbColor(colors, field.At(x, y))
+	}
+	p := field.At(x, y)
+	if colors.Lighting {
+		return shade(c.escapeColor(p), colors.light(p))
+	}
+	return c.escapeColor(p)
+}
+
+// escapeColor colors an escape-time point with the coloring algorithm.
+func (c fieldColorer) escapeColor(p Point) color.Color {
+	colors, field := c.colors, c.field
+	switch colors.Coloring {
+	case ColoringDistance:
+		return distanceColor(colors, p, field)
+	case ColoringHistogram:
+		return histogramColor(colors, p, field, c.cdf)
+	case ColoringOrbitTrap:
+		return trapColor(colors, p)
+	case ColoringStripe, ColoringTriangle:
+		return averageColor(colors, p)
+	}
+	return getColor(colors, p, field)
+}
+
+// distanceColor colors escaped points by their estimated distance to the set
+// measured in pixels, so the boundary stays crisp and thin at any zoom.
+// Points without a distance estimate fall back to iteration coloring.
+func distanceColor(colors ColorParams, p Point, field *IterField) color.Color {
+	dist := p.Distance()
+	if !p.Escaped || math.IsInf(dist, 1) || field.Pixel <= 0 {
+		return getColor(colors, p, field)
+	}
+	t := math.Min(1, math.Log2(1+dist/field.Pixel)/distanceOctaves)
+	return colors.scheme(t)
+}
+
+// scheme returns the color at position t in [0, 1] of the color scheme,
+// repeated ColorDensity times and shifted by ColorOffset.
+func (c ColorParams) scheme(t float64) color.Color {
+	if c.ColorDensity != 1 || c.ColorOffset != 0 {
+		t = t*c.ColorDensity + c.ColorOffset
+		t -= math.Floor(t)
+	}
+	return schemeColor(c.ColorMode, t)
+}
+
+// schemeColor returns the color of a scheme at position t in [0, 1].
+// Unknown schemes are grayscale.
+func schemeColor(scheme int, t float64) color.Color {
+	if scheme < 0 || scheme >= len(palettes) {
+		scheme = ColorGrayscale
+	}
+	return palettes[scheme].At(t)
+}
+
+// ColorizeText colors field into a params.Width x params.Height text buffer,
+// scaling it up when the field is smaller (e.g. a coarse progressive pass).
+func ColorizeText(params MandelbrotParams, field *IterField) [][]string {
+	colorer := newFieldColorer(params.ColorParams, field)
+	buffer := make([][]string, params.Height)
+	for y := range params.Height {
+		buffer[y] = make([]string, params.Width)
+		for x := range params.Width {
+			buffer[y][x] = getColorString(colorer.at(x*field.Width/params.Width, y*field.Height/params.Height))
+		}
+	}
+	return buffer
+}
+
+// ColorizeImage colors field into an image of the same size.
+func ColorizeImage(ctx context.Context, params MandelbrotParams, field *IterField) (*image.RGBA, error) {
+	img := image.NewRGBA(image.Rect(0, 0, field.Width, field.Height))
+	colorer := newFieldColorer(params.ColorParams, field)
+	err := forEachTile(withoutProgress(ctx), frame(field.Width, field.Height), params.Workers, func(t tile) {
+		for y := t.y0; y < t.y1; y++ {
+			for x := t.x0; x < t.x1; x++ {
+				img.Set(x, y, colorer.at(x, y))
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
 	}
+	return img, nil
 }
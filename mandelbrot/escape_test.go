@@ -0,0 +1,34 @@
+package mandelbrot
+
+import "testing"
+
+// benchmarkPoints samples the default view of the Mandelbrot set.
+func benchmarkPoints() []complex128 {
+	var points []complex128
+	for y := range 60 {
+		for x := range 100 {
+			points = append(points, complex(-2.2+3.2*float64(x)/100, -1.2+2.4*float64(y)/60))
+		}
+	}
+	return points
+}
+
+// BenchmarkEscapeTime and BenchmarkEscapeTimeFormula compare the quadratic
+// fast path with the general loop running the same formula.
+func BenchmarkEscapeTime(b *testing.B) {
+	points := benchmarkPoints()
+	for range b.N {
+		for _, c := range points {
+			escapeTime(0, c, 500, false, false)
+		}
+	}
+}
+
+func BenchmarkEscapeTimeFormula(b *testing.B) {
+	points := benchmarkPoints()
+	for range b.N {
+		for _, c := range points {
+			escapeTimeFormula(Quadratic{}, 0, c, 500, false, false, nil)
+		}
+	}
+}
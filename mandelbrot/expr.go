@@ -0,0 +1,451 @@
+package mandelbrot
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Default custom formula and bailout condition
+const (
+	DefaultExpression = "z^2 + c"
+	DefaultBailout    = "abs(z) > 2"
+)
+
+// SyntaxError reports an invalid formula expression.
+type SyntaxError struct {
+	Pos int // Column of the error, starting at 1
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Pos, e.Msg)
+}
+
+// expr is a compiled expression of the formula language.
+type expr func(z, c complex128) complex128
+
+// exprFunctions holds the single-argument functions of the formula language
+var exprFunctions = map[string]func(complex128) complex128{
+	"sin":  cmplx.Sin,
+	"cos":  cmplx.Cos,
+	"tan":  cmplx.Tan,
+	"sinh": cmplx.Sinh,
+	"cosh": cmplx.Cosh,
+	"exp":  cmplx.Exp,
+	"log":  cmplx.Log,
+	"sqrt": cmplx.Sqrt,
+	"conj": cmplx.Conj,
+	"abs":  func(z complex128) complex128 { return complex(cmplx.Abs(z), 0) },
+	"re":   func(z complex128) complex128 { return complex(real(z), 0) },
+	"im":   func(z complex128) complex128 { return complex(imag(z), 0) },
+}
+
+// exprConstants holds the named constants of the formula language
+var exprConstants = map[string]complex128{
+	"i":  1i,
+	"pi": math.Pi,
+	"e":  math.E,
+}
+
+// Custom is a formula compiled from a user expression in z and c, with its
+// own bailout condition.
+type Custom struct {
+	step    expr
+	bailout func(z, c complex128) bool
+}
+
+func (f Custom) Step(z, c complex128) complex128 { return f.step(z, c) }
+
+// Escaped reports whether the orbit met the bailout condition.
+func (f Custom) Escaped(z, c complex128) bool { return f.bailout(z, c) }
+
+// CompileFormula compiles an iteration expression such as "z^2 + c" and a
+// bailout condition such as "abs(z) > 2". Comparisons use the real parts.
+func CompileFormula(expression, bailout string) (Custom, error) {
+	step, err := parseExpr(expression, false)
+	if err != nil {
+		return Custom{}, fmt.Errorf("formula: %w", err)
+	}
+	condition, err := parseExpr(bailout, true)
+	if err != nil {
+		return Custom{}, fmt.Errorf("bailout: %w", err)
+	}
+	return Custom{
+		step:    step.eval,
+		bailout: func(z, c complex128) bool { return real(condition.eval(z, c)) != 0 },
+	}, nil
+}
+
+// node is a compiled sub-expression. Constant nodes are folded while parsing.
+type node struct {
+	eval     expr
+	constant bool
+}
+
+func constNode(v complex128) node {
+	return node{eval: func(z, c complex128) complex128 { return v }, constant: true}
+}
+
+// fold evaluates constant nodes once, leaving the others as they are.
+func fold(n node) node {
+	if n.constant {
+		return constNode(n.eval(0, 0))
+	}
+	return n
+}
+
+type token struct {
+	kind string // "num", "ident", "op" or "end"
+	text string
+	pos  int
+}
+
+// tokenize splits an expression into tokens.
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		r := rune(s[i])
+		switch {
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			i++
+		case isDigit(s[i]) || r == '.':
+			start := i
+			for i < len(s) && (isDigit(s[i]) || s[i] == '.') {
+				i++
+			}
+			// Scientific notation, unless the e is the constant
+			if i+1 < len(s) && (s[i] == 'e' || s[i] == 'E') {
+				j := i + 1
+				if s[j] == '+' || s[j] == '-' {
+					j++
+				}
+				if j < len(s) && isDigit(s[j]) {
+					i = j
+					for i < len(s) && isDigit(s[i]) {
+						i++
+					}
+				}
+			}
+			// Imaginary literal such as 0.5i
+			if i < len(s) && s[i] == 'i' && (i+1 == len(s) || !isIdentChar(s[i+1])) {
+				i++
+			}
+			tokens = append(tokens, token{"num", s[start:i], start + 1})
+		case isLetter(s[i]) || r == '_':
+			start := i
+			for i < len(s) && isIdentChar(s[i]) {
+				i++
+			}
+			tokens = append(tokens, token{"ident", strings.ToLower(s[start:i]), start + 1})
+		case (r == '<' || r == '>') && i+1 < len(s) && s[i+1] == '=':
+			tokens = append(tokens, token{"op", s[i : i+2], i + 1})
+			i += 2
+		case strings.ContainsRune("+-*/^(),<>", r):
+			tokens = append(tokens, token{"op", string(r), i + 1})
+			i++
+		default:
+			// Everything accepted so far is ASCII, so the byte offset is
+			// also the column
+			r, _ := utf8.DecodeRuneInString(s[i:])
+			return nil, &SyntaxError{i + 1, fmt.Sprintf("unexpected character %q", r)}
+		}
+	}
+	return append(tokens, token{"end", "", len(s) + 1}), nil
+}
+
+// The formula language is ASCII; bytes of other characters are none of these.
+func isDigit(b byte) bool  { return b >= '0' && b <= '9' }
+func isLetter(b byte) bool { return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' }
+
+func isIdentChar(b byte) bool {
+	return isLetter(b) || isDigit(b) || b == '_'
+}
+
+// parser is a recursive descent parser that compiles while it parses.
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != "end" {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is the operator op.
+func (p *parser) accept(op string) bool {
+	if t := p.peek(); t.kind == "op" && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(op string) error {
+	if !p.accept(op) {
+		return p.unexpected(fmt.Sprintf("expected %q", op))
+	}
+	return nil
+}
+
+// unexpected returns an error about the next token.
+func (p *parser) unexpected(msg string) error {
+	t := p.peek()
+	if t.kind == "end" {
+		return &SyntaxError{t.pos, msg + ", got end of input"}
+	}
+	return &SyntaxError{t.pos, fmt.Sprintf("%s, got %q", msg, t.text)}
+}
+
+// parseExpr compiles s. Conditions must be a comparison of two expressions,
+// which evaluates to 1 when true and 0 otherwise.
+func parseExpr(s string, condition bool) (node, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return node{}, err
+	}
+	p := &parser{tokens: tokens}
+	if p.peek().kind == "end" {
+		return node{}, &SyntaxError{1, "empty expression"}
+	}
+	n, err := p.sum()
+	if err != nil {
+		return node{}, err
+	}
+	if condition {
+		if n, err = p.comparison(n); err != nil {
+			return node{}, err
+		}
+	}
+	if p.peek().kind != "end" {
+		return node{}, p.unexpected("expected operator")
+	}
+	return n, nil
+}
+
+// comparison compiles "left <op> right", comparing real parts.
+func (p *parser) comparison(left node) (node, error) {
+	var cmp func(a, b float64) bool
+	switch p.peek().text {
+	case "<":
+		cmp = func(a, b float64) bool { return a < b }
+	case "<=":
+		cmp = func(a, b float64) bool { return a <= b }
+	case ">":
+		cmp = func(a, b float64) bool { return a > b }
+	case ">=":
+		cmp = func(a, b float64) bool { return a >= b }
+	default:
+		return node{}, p.unexpected("expected comparison (<, <=, >, >=)")
+	}
+	p.next()
+	right, err := p.sum()
+	if err != nil {
+		return node{}, err
+	}
+	l, r := left.eval, right.eval
+	return node{eval: func(z, c complex128) complex128 {
+		if cmp(real(l(z, c)), real(r(z, c))) {
+			return 1
+		}
+		return 0
+	}}, nil
+}
+
+// sum compiles terms joined by + and -.
+func (p *parser) sum() (node, error) {
+	left, err := p.product()
+	if err != nil {
+		return node{}, err
+	}
+	for {
+		var op func(a, b complex128) complex128
+		switch {
+		case p.accept("+"):
+			op = func(a, b complex128) complex128 { return a + b }
+		case p.accept("-"):
+			op = func(a, b complex128) complex128 { return a - b }
+		default:
+			return left, nil
+		}
+		right, err := p.product()
+		if err != nil {
+			return node{}, err
+		}
+		left = binary(op, left, right)
+	}
+}
+
+// product compiles factors joined by * and /.
+func (p *parser) product() (node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return node{}, err
+	}
+	for {
+		var op func(a, b complex128) complex128
+		switch {
+		case p.accept("*"):
+			op = func(a, b complex128) complex128 { return a * b }
+		case p.accept("/"):
+			op = func(a, b complex128) complex128 { return a / b }
+		default:
+			return left, nil
+		}
+		right, err := p.unary()
+		if err != nil {
+			return node{}, err
+		}
+		left = binary(op, left, right)
+	}
+}
+
+// unary compiles a negation or a power.
+func (p *parser) unary() (node, error) {
+	if p.accept("-") {
+		n, err := p.unary()
+		if err != nil {
+			return node{}, err
+		}
+		f := n.eval
+		return fold(node{eval: func(z, c complex128) complex128 { return -f(z, c) }, constant: n.constant}), nil
+	}
+	if p.accept("+") {
+		return p.unary()
+	}
+	return p.power()
+}
+
+// power compiles base^exponent, which is right associative.
+func (p *parser) power() (node, error) {
+	base, err := p.primary()
+	if err != nil {
+		return node{}, err
+	}
+	if !p.accept("^") {
+		return base, nil
+	}
+	exponent, err := p.unary()
+	if err != nil {
+		return node{}, err
+	}
+	return pow(base, exponent), nil
+}
+
+// primary compiles numbers, names, calls and parenthesized expressions.
+func (p *parser) primary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case "num":
+		text, imaginary := strings.CutSuffix(t.text, "i")
+		v, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return node{}, &SyntaxError{t.pos, fmt.Sprintf("invalid number %q", t.text)}
+		}
+		if imaginary {
+			return constNode(complex(0, v)), nil
+		}
+		return constNode(complex(v, 0)), nil
+
+	case "ident":
+		if p.accept("(") {
+			return p.call(t)
+		}
+		switch t.text {
+		case "z":
+			return node{eval: func(z, c complex128) complex128 { return z }}, nil
+		case "c":
+			return node{eval: func(z, c complex128) complex128 { return c }}, nil
+		}
+		if v, ok := exprConstants[t.text]; ok {
+			return constNode(v), nil
+		}
+		return node{}, &SyntaxError{t.pos, fmt.Sprintf("unknown variable %q (use z, c, i, pi or e)", t.text)}
+
+	case "op":
+		if t.text == "(" {
+			n, err := p.sum()
+			if err != nil {
+				return node{}, err
+			}
+			return n, p.expect(")")
+		}
+	}
+	if t.kind != "end" {
+		p.pos--
+	}
+	return node{}, p.unexpected("expected value")
+}
+
+// call compiles a function call after its opening parenthesis.
+func (p *parser) call(name token) (node, error) {
+	var args []node
+	for {
+		arg, err := p.sum()
+		if err != nil {
+			return node{}, err
+		}
+		args = append(args, arg)
+		if !p.accept(",") {
+			break
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return node{}, err
+	}
+
+	if name.text == "pow" {
+		if len(args) != 2 {
+			return node{}, &SyntaxError{name.pos, fmt.Sprintf("pow takes 2 arguments, got %d", len(args))}
+		}
+		return pow(args[0], args[1]), nil
+	}
+	f, ok := exprFunctions[name.text]
+	if !ok {
+		return node{}, &SyntaxError{name.pos, fmt.Sprintf("unknown function %q", name.text)}
+	}
+	if len(args) != 1 {
+		return node{}, &SyntaxError{name.pos, fmt.Sprintf("%s takes 1 argument, got %d", name.text, len(args))}
+	}
+	arg := args[0].eval
+	return fold(node{eval: func(z, c complex128) complex128 { return f(arg(z, c)) }, constant: args[0].constant}), nil
+}
+
+// binary combines two nodes with op, folding constants.
+func binary(op func(a, b complex128) complex128, left, right node) node {
+	l, r := left.eval, right.eval
+	return fold(node{
+		eval:     func(z, c complex128) complex128 { return op(l(z, c), r(z, c)) },
+		constant: left.constant && right.constant,
+	})
+}
+
+// pow compiles base^exponent, using repeated multiplication for small
+// constant integer exponents.
+func pow(base, exponent node) node {
+	b := base.eval
+	if exponent.constant {
+		n := exponent.eval(0, 0)
+		if imag(n) == 0 && real(n) == math.Trunc(real(n)) && real(n) >= 1 && real(n) <= 16 {
+			k := int(real(n))
+			return fold(node{eval: func(z, c complex128) complex128 {
+				v := b(z, c)
+				w := v
+				for range k - 1 {
+					w *= v
+				}
+				return w
+			}, constant: base.constant})
+		}
+	}
+	return binary(cmplx.Pow, base, exponent)
+}
@@ -0,0 +1,137 @@
+package mandelbrot
+
+import (
+	"math/cmplx"
+	"testing"
+)
+
+func TestParseExpr(t *testing.T) {
+	tests := []struct {
+		expr     string
+		z, c     complex128
+		want     complex128
+		constant bool // Whether the whole expression folds to a constant
+	}{
+		{"1 + 2 * 3", 0, 0, 7, true},
+		{"(1 + 2) * 3", 0, 0, 9, true},
+		{"7 - 2 - 1", 0, 0, 4, true},
+		{"8 / 4 / 2", 0, 0, 1, true},
+		{"2^3^2", 0, 0, 512, true},
+		{"-2^2", 0, 0, -4, true},
+		{"2 * -3", 0, 0, -6, true},
+		{"--z", 2, 0, 2, false},
+		{"+z", 2, 0, 2, false},
+		{"0^0", 0, 0, 1, true},
+		{"z^0", 0, 0, 1, false},
+		{"z^0.5", 4, 0, 2, false},
+		{"z^2 + c", 1 + 1i, 0.5, 0.5 + 2i, false},
+		{"Z^2 + C", 1 + 1i, 0.5, 0.5 + 2i, false},
+		{"pow(z, 3)", 2, 0, 8, false},
+		{"z*z*z - 1", 2, 0, 7, false},
+		{"abs(3 + 4i)", 0, 0, 5, true},
+		{"re(z) + im(z)", 2 + 3i, 0, 5, false},
+		{"conj(z)", 2 + 3i, 0, 2 - 3i, false},
+		{"sin(0) + cos(0) + exp(0)", 0, 0, 2, true},
+		{"i * i", 0, 0, -1, true},
+		{"sin(pi / 2)", 0, 0, 1, true},
+		{"log(e)", 0, 0, 1, true},
+		{"1.5e3 + .5", 0, 0, 1500.5, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			n, err := parseExpr(tt.expr, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := n.eval(tt.z, tt.c); cmplx.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if n.constant != tt.constant {
+				t.Errorf("constant = %v, want %v", n.constant, tt.constant)
+			}
+		})
+	}
+}
+
+func TestParseCondition(t *testing.T) {
+	tests := []struct {
+		expr string
+		z    complex128
+		want complex128
+	}{
+		{"abs(z) > 2", 3, 1},
+		{"abs(z) > 2", 1, 0},
+		{"abs(z) >= 2", 2, 1},
+		{"re(z) < 0", -1, 1},
+		{"re(z) <= 0", 1, 0},
+		{"im(z) + 1 > 2 * 1", 2i, 1},
+	}
+	for _, tt := range tests {
+		n, err := parseExpr(tt.expr, true)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.expr, err)
+		}
+		if got := n.eval(tt.z, 0); got != tt.want {
+			t.Errorf("%s at z = %v: got %v, want %v", tt.expr, tt.z, got, tt.want)
+		}
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	tests := []struct {
+		expr      string
+		condition bool
+		want      string
+	}{
+		{"", false, "column 1: empty expression"},
+		{"   ", false, "column 1: empty expression"},
+		{"z +", false, "column 4: expected value, got end of input"},
+		{"z ^ * 2", false, `column 5: expected value, got "*"`},
+		{"(z", false, `column 3: expected ")", got end of input`},
+		{"z)", false, `column 2: expected operator, got ")"`},
+		{"z c", false, `column 3: expected operator, got "c"`},
+		{"2e", false, `column 2: expected operator, got "e"`},
+		{"z > 2", false, `column 3: expected operator, got ">"`},
+		{"x + 1", false, `column 1: unknown variable "x" (use z, c, i, pi or e)`},
+		{"foo(z)", false, `column 1: unknown function "foo"`},
+		{"sin(z, c)", false, "column 1: sin takes 1 argument, got 2"},
+		{"pow(z)", false, "column 1: pow takes 2 arguments, got 1"},
+		{"1.2.3", false, `column 1: invalid number "1.2.3"`},
+		{"z $ c", false, "column 3: unexpected character '$'"},
+		{"z² + c", false, "column 2: unexpected character '²'"},
+		{"zé", false, "column 2: unexpected character 'é'"},
+		{"z\u00a0+ c", false, `column 2: unexpected character '\u00a0'`},
+		{"abs(z)", true, "column 7: expected comparison (<, <=, >, >=), got end of input"},
+		{"abs(z) = 2", true, "column 8: unexpected character '='"},
+	}
+	for _, tt := range tests {
+		_, err := parseExpr(tt.expr, tt.condition)
+		if err == nil {
+			t.Errorf("%q: no error, want %q", tt.expr, tt.want)
+			continue
+		}
+		if err.Error() != tt.want {
+			t.Errorf("%q: got error %q, want %q", tt.expr, err, tt.want)
+		}
+	}
+}
+
+func TestCompileFormula(t *testing.T) {
+	f, err := CompileFormula(DefaultExpression, DefaultBailout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.Step(1i, 1); got != 0 {
+		t.Errorf("Step(i, 1) = %v, want 0", got)
+	}
+	if !f.Escaped(3, 0) || f.Escaped(1, 0) {
+		t.Error("default bailout should escape past |z| = 2 only")
+	}
+
+	if _, err := CompileFormula("z^2 +", DefaultBailout); err == nil || err.Error() != "formula: column 6: expected value, got end of input" {
+		t.Errorf("bad formula: got error %v", err)
+	}
+	if _, err := CompileFormula(DefaultExpression, "abs(z)"); err == nil || err.Error() != "bailout: column 7: expected comparison (<, <=, >, >=), got end of input" {
+		t.Errorf("bad bailout: got error %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package mandelbrot
+
+import (
+	"context"
+	"math"
+	"math/cmplx"
+)
+
+// Point is the escape-time result of a single pixel.
+type Point struct {
+	Iter    int        // Iterations until escape, MaxIter for interior points
+	Z       complex128 // Final z, used for smooth coloring; the orbit trap for Mandelbulb hits
+	Deriv   complex128 // Derivative of the final z by the pixel, 0 when unknown or not tracked
+	Escaped bool
+	Root    uint8   // Root a Newton orbit converged to
+	Value   float64 // Lyapunov exponent, or shading of Mandelbulb hits
+}
+
+// IterField holds the escape-time results of a render target in row-major
+// order. It is independent of coloring, so palette changes only need
+// Colorize instead of a new render.
+type IterField struct {
+	Width, Height int
+	MaxIter       int
+	Fractal       int
+	Roots         int     // Number of Newton roots, 0 for escape-time fields
+	Pixel         float64 // Size of a pixel in the complex plane
+	Degree        float64 // Growth of |z| per iteration, for smoothing
+	Imprecise     bool    // The view needs more than float64 but was rendered with it
+	Points        []Point
+	Stats         RenderStats
+	Flat          bool // Subdivision filled escaped areas with copies of one point
+	Derivs        bool // Escaped points carry the derivative of z
+
+	// Orbit visits per pixel and channel of Buddhabrot fields, with the
+	// highest count of each channel
+	Channels int
+	Density  []uint32
+	Peak     []uint32
+}
+
+func newIterField(width, height, maxIter int) *IterField {
+	return &IterField{
+		Width:   width,
+		Height:  height,
+		MaxIter: maxIter,
+		Degree:  2,
+		Points:  make([]Point, width*height),
+	}
+}
+
+// Supports reports whether the field can be colored with colors, or was
+// rendered for a coloring that needs less of each point.
+func (f *IterField) Supports(colors ColorParams) bool {
+	return (!f.Flat || colors.flatFill()) && (f.Derivs || !colors.needsDeriv())
+}
+
+// needsDeriv reports whether the coloring uses the derivative of z, which
+// the kernels only track when asked to.
+func (c ColorParams) needsDeriv() bool {
+	return c.Coloring == ColoringDistance || c.Lighting
+}
+
+// At returns the point at pixel (x, y).
+func (f *IterField) At(x, y int) Point {
+	return f.Points[y*f.Width+x]
+}
+
+// escaped returns the result of an orbit that left the bailout radius at iteration i.
+func escaped(i int, z complex128) Point {
+	return Point{Iter: i, Z: z, Escaped: true}
+}
+
+// escapedDeriv is escaped with the derivative of the final z.
+func escapedDeriv(i int, z, dz complex128) Point {
+	return Point{Iter: i, Z: z, Deriv: dz, Escaped: true}
+}
+
+// derivStart returns the starting derivative of an orbit and the constant
+// added at each step: orbits are derived by c, Julia orbits by their start.
+func derivStart(julia bool) (dz, dc complex128) {
+	if julia {
+		return 1, 0
+	}
+	return 0, 1
+}
+
+// interior returns the result of an orbit that never escaped.
+func interior(maxIter int, z complex128) Point {
+	return Point{Iter: maxIter, Z: z}
+}
+
+// smoothIter returns the iteration count of p, smoothed with the final |z|
+// when smooth is set.
+func (p Point) smoothIter(field *IterField, smooth bool) float64 {
+	if !smooth {
+		return float64(p.Iter)
+	}
+	return smoothIterations(p.Iter, cmplx.Abs(p.Z), field.Degree, field.MaxIter)
+}
+
+// Distance returns the estimated distance of an escaped point to the
+// fractal, 0 for interior points and +Inf when the derivative is unknown.
+func (p Point) Distance() float64 {
+	if !p.Escaped {
+		return 0
+	}
+	absDeriv := cmplx.Abs(p.Deriv)
+	if absDeriv == 0 || math.IsInf(absDeriv, 0) || math.IsNaN(absDeriv) {
+		return math.Inf(1)
+	}
+	absZ := cmplx.Abs(p.Z)
+	return absZ * math.Log(absZ) / absDeriv
+}
+
+// RenderField computes the escape-time field of a width x height target.
+// It stops early and returns ctx.Err() when ctx is cancelled.
+func RenderField(ctx context.Context, params MandelbrotParams, width, height int) (*IterField, error) {
+	if isDensity(params.Fractal) {
+		var field *IterField
+		err := renderDensity(ctx, params, width, height, false, func(f *IterField) error {
+			field = f
+			return nil
+		})
+		return field, err
+	}
+	field := newIterField(width, height, params.MaxIter)
+	if err := renderRegions(ctx, params, field, []tile{frame(width, height)}, nil); err != nil {
+		return nil, err
+	}
+	return field, nil
+}
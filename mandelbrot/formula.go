@@ -0,0 +1,212 @@
+package mandelbrot
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// Constants for built-in formulas
+const (
+	FormulaQuadratic   = iota // z = z*z + c
+	FormulaMultibrot          // z = z^n + c
+	FormulaBurningShip        // z = (|Re z| + i|Im z|)^2 + c
+	FormulaTricorn            // z = conj(z)^2 + c
+	FormulaCeltic             // z = |Re z^2| + i Im z^2 + c
+	FormulaBuffalo            // z = |Re z^2| + i|Im z^2| + c
+	FormulaCustom             // user expression, see CompileFormula
+	FormulaCount
+)
+
+var FormulaNames = map[int]string{
+	FormulaQuadratic:   "Mandelbrot",
+	FormulaMultibrot:   "Multibrot",
+	FormulaBurningShip: "Burning Ship",
+	FormulaTricorn:     "Tricorn",
+	FormulaCeltic:      "Celtic",
+	FormulaBuffalo:     "Buffalo",
+	FormulaCustom:      "Custom",
+}
+
+// formulaCenters holds the default view center of each formula
+var formulaCenters = map[int]complex128{
+	FormulaQuadratic:   complex(-0.5, 0),
+	FormulaMultibrot:   complex(0, 0),
+	FormulaBurningShip: complex(-0.5, -0.5),
+	FormulaTricorn:     complex(-0.25, 0),
+	FormulaCeltic:      complex(-0.5, 0),
+	FormulaBuffalo:     complex(-0.5, -0.3),
+	FormulaCustom:      complex(0, 0),
+}
+
+// DefaultExponent is the Multibrot exponent used when none is set
+const DefaultExponent = 3.0
+
+// Formula is a single iteration step of an escape-time fractal. Orbits start
+// at z = 0 with c the pixel, or at z = pixel with c the seed for Julia sets.
+type Formula interface {
+	Step(z, c complex128) complex128
+}
+
+// Bailout is implemented by formulas with their own escape condition instead
+// of |z| > 2.
+type Bailout interface {
+	Escaped(z, c complex128) bool
+}
+
+// Derivative is implemented by formulas that are holomorphic in z, so
+// distance estimation works for them. Deriv returns dz times the derivative
+// of Step by z.
+type Derivative interface {
+	Deriv(z, dz complex128) complex128
+}
+
+// Quadratic is the classic Mandelbrot formula z^2 + c.
+type Quadratic struct{}
+
+func (Quadratic) Step(z, c complex128) complex128 { return z*z + c }
+
+func (Quadratic) Deriv(z, dz complex128) complex128 { return 2 * z * dz }
+
+// Multibrot raises z to a real exponent, z^n + c.
+type Multibrot struct {
+	Exponent float64
+}
+
+func (f Multibrot) Step(z, c complex128) complex128 {
+	n := f.Exponent
+	if n == math.Trunc(n) && n >= 1 && n <= 16 {
+		// Repeated multiplication is much faster than cmplx.Pow
+		w := z
+		for range int(n) - 1 {
+			w *= z
+		}
+		return w + c
+	}
+	if z == 0 {
+		return c
+	}
+	return cmplx.Pow(z, complex(n, 0)) + c
+}
+
+func (f Multibrot) Deriv(z, dz complex128) complex128 {
+	if z == 0 {
+		return 0
+	}
+	// n z^(n-1) dz, with z^n from Step
+	return complex(f.Exponent, 0) * f.Step(z, 0) / z * dz
+}
+
+// BurningShip folds z into the first quadrant before squaring.
+type BurningShip struct{}
+
+func (BurningShip) Step(z, c complex128) complex128 {
+	z = complex(math.Abs(real(z)), math.Abs(imag(z)))
+	return z*z + c
+}
+
+// Tricorn (Mandelbar) squares the conjugate of z.
+type Tricorn struct{}
+
+func (Tricorn) Step(z, c complex128) complex128 {
+	z = cmplx.Conj(z)
+	return z*z + c
+}
+
+// Celtic takes the absolute value of the real part of z^2.
+type Celtic struct{}
+
+func (Celtic) Step(z, c complex128) complex128 {
+	z = z * z
+	return complex(math.Abs(real(z)), imag(z)) + c
+}
+
+// Buffalo takes the absolute value of both parts of z^2.
+type Buffalo struct{}
+
+func (Buffalo) Step(z, c complex128) complex128 {
+	z = z * z
+	return complex(math.Abs(real(z)), math.Abs(imag(z))) + c
+}
+
+// degree returns how fast |z| grows per iteration once it is large, the
+// power of z in the formula, which smooth coloring divides out.
+func (p MandelbrotParams) degree() float64 {
+	if p.Formula == FormulaMultibrot && p.Exponent > 1 {
+		return p.Exponent
+	}
+	return 2
+}
+
+// NewFormula returns the built-in formula of the given kind. Custom formulas
+// are compiled with CompileFormula instead.
+func NewFormula(kind int, exponent float64) Formula {
+	switch kind {
+	case FormulaMultibrot:
+		return Multibrot{Exponent: exponent}
+	case FormulaBurningShip:
+		return BurningShip{}
+	case FormulaTricorn:
+		return Tricorn{}
+	case FormulaCeltic:
+		return Celtic{}
+	case FormulaBuffalo:
+		return Buffalo{}
+	default:
+		return Quadratic{}
+	}
+}
+
+// escapeTimeFormula iterates f from z until it escapes, past radius 2 or by
+// the formula's own bailout. Like escapeTime, it stops early on periodic
+// orbits, and tracks the derivative with derivs when f has one. Statistics of
+// the orbit are collected when stats is set, escaping past its radius.
+func escapeTimeFormula(f Formula, z, c complex128, maxIter int, julia, derivs bool, stats *orbitStats) (Point, shortcut) {
+	bailout, hasBailout := f.(Bailout)
+	derivative, hasDeriv := f.(Derivative)
+	hasDeriv = hasDeriv && derivs
+	dz, dc := derivStart(julia)
+	var s orbitStats
+	radius2 := 4.0
+	if stats != nil {
+		s = stats.start()
+		radius2 = s.bailout()
+	}
+	saved := z
+	period, limit := 0, 1
+	for i := range maxIter {
+		if hasDeriv {
+			dz = derivative.Deriv(z, dz) + dc
+		}
+		z = f.Step(z, c)
+		if stats != nil {
+			s.add(z, c)
+		}
+		var escapes bool
+		if hasBailout {
+			escapes = bailout.Escaped(z, c) || cmplx.IsNaN(z) || cmplx.IsInf(z)
+		} else {
+			escapes = real(z)*real(z)+imag(z)*imag(z) > radius2
+		}
+		if escapes {
+			if !hasDeriv {
+				dz = 0
+			}
+			p := escapedDeriv(i, z, dz)
+			p.Value = s.value(p)
+			return p, noShortcut
+		}
+
+		d := z - saved
+		if real(d)*real(d)+imag(d)*imag(d) < periodTolerance*periodTolerance {
+			p := interior(maxIter, z)
+			p.Value = s.value(p)
+			return p, periodShortcut
+		}
+		if period++; period == limit {
+			saved, period, limit = z, 0, limit*2
+		}
+	}
+	p := interior(maxIter, z)
+	p.Value = s.value(p)
+	return p, noShortcut
+}
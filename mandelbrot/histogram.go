@@ -0,0 +1,43 @@
+package mandelbrot
+
+import (
+	"image/color"
+	"math"
+)
+
+// iterationCDF returns the cumulative histogram of the iteration counts of
+// the escaped points of field: cdf[i] is the fraction of them that escaped in
+// fewer than i iterations.
+func iterationCDF(field *IterField) []float64 {
+	counts := make([]int, field.MaxIter+1)
+	total := 0
+	for _, p := range field.Points {
+		if p.Escaped && p.Iter < len(counts) {
+			counts[p.Iter]++
+			total++
+		}
+	}
+	cdf := make([]float64, len(counts)+1)
+	for i, n := range counts {
+		cdf[i+1] = cdf[i] + float64(n)
+	}
+	if total > 0 {
+		for i := range cdf {
+			cdf[i] /= float64(total)
+		}
+	}
+	return cdf
+}
+
+// histogramColor colors an escaped point by the fraction of the frame that
+// escaped before it, spreading the palette evenly over the frame whatever
+// MaxIter is. Smooth iteration counts interpolate between histogram bins.
+func histogramColor(colors ColorParams, p Point, field *IterField, cdf []float64) color.Color {
+	if !p.Escaped {
+		return color.RGBA{0, 0, 0, 255}
+	}
+	v := math.Max(0, math.Min(float64(field.MaxIter), p.smoothIter(field, colors.Smooth)))
+	i := int(v)
+	t := cdf[i] + (v-float64(i))*(cdf[i+1]-cdf[i])
+	return colors.scheme(t)
+}
@@ -0,0 +1,81 @@
+package mandelbrot
+
+import (
+	"math/cmplx"
+	"sync/atomic"
+)
+
+// periodTolerance is how close an orbit must return to a saved point to be
+// treated as periodic.
+const periodTolerance = 1e-15
+
+// bulbMargin is the rounding error, relative to |c|, that the bulb test
+// allows for when a pixel's coordinate only approximates its point.
+const bulbMargin = 0x1p-50
+
+// shortcut records how the kernel finished a pixel.
+type shortcut int
+
+const (
+	noShortcut     shortcut = iota
+	bulbShortcut            // inside the main cardioid or the period-2 bulb
+	periodShortcut          // the orbit was found to be periodic
+)
+
+// RenderStats counts how the pixels of a field were computed.
+type RenderStats struct {
+	Pixels   int64 // Pixels rendered
+	Bulb     int64 // Interior pixels detected analytically, without iterating
+	Periodic int64 // Interior pixels stopped early by periodicity checking
+	Filled   int64 // Pixels filled by subdivision without iterating
+}
+
+// Skipped returns the fraction of pixels that were short-circuited.
+func (s RenderStats) Skipped() float64 {
+	if s.Pixels == 0 {
+		return 0
+	}
+	return float64(s.Bulb+s.Periodic+s.Filled) / float64(s.Pixels)
+}
+
+// count tallies a single pixel.
+func (s *RenderStats) count(how shortcut) {
+	s.Pixels++
+	switch how {
+	case bulbShortcut:
+		s.Bulb++
+	case periodShortcut:
+		s.Periodic++
+	}
+}
+
+// addTo atomically adds s to the stats of a field shared between workers.
+func (s RenderStats) addTo(dst *RenderStats) {
+	atomic.AddInt64(&dst.Pixels, s.Pixels)
+	atomic.AddInt64(&dst.Bulb, s.Bulb)
+	atomic.AddInt64(&dst.Periodic, s.Periodic)
+	atomic.AddInt64(&dst.Filled, s.Filled)
+}
+
+// inMainBulbs reports whether c lies in the main cardioid or the period-2 bulb.
+func inMainBulbs(c complex128) bool {
+	x, y := real(c), imag(c)
+	y2 := y * y
+	q := (x-0.25)*(x-0.25) + y2
+	if q*(q+x-0.25) <= 0.25*y2 {
+		return true
+	}
+	return (x+1)*(x+1)+y2 <= 1.0/16
+}
+
+// inMainBulbsMargin is inMainBulbs for a point known only to within eps of c:
+// it holds when the whole disc of radius eps around c is inside.
+func inMainBulbsMargin(c complex128, eps float64) bool {
+	if cmplx.Abs(c+1)+eps < 0.25 {
+		return true
+	}
+	// The multiplier l of the fixed point has |l| < 1 inside the cardioid.
+	// Moving c by eps moves l by about 2 eps / |1-l|, doubled to be safe.
+	l := 1 - cmplx.Sqrt(1-4*c)
+	return cmplx.Abs(l)+4*eps/cmplx.Abs(1-l) < 1
+}
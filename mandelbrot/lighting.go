@@ -0,0 +1,38 @@
+package mandelbrot
+
+import (
+	"image/color"
+	"math"
+	"math/cmplx"
+)
+
+const (
+	// DefaultLightAngle lights the fractal from the top right.
+	DefaultLightAngle = math.Pi / 4
+	// DefaultLightHeight is the default height of the light above the plane.
+	DefaultLightHeight = 1.5
+)
+
+// light returns the brightness of an escaped point under the light, treating
+// the potential of the fractal as a surface whose normal is z/dz. Points
+// without a derivative stay unlit.
+func (c ColorParams) light(p Point) float64 {
+	if !p.Escaped || p.Deriv == 0 {
+		return 1
+	}
+	u := p.Z / p.Deriv
+	absU := cmplx.Abs(u)
+	if absU == 0 || math.IsInf(absU, 0) || math.IsNaN(absU) {
+		return 1
+	}
+	u /= complex(absU, 0)
+	dir := cmplx.Rect(1, -c.LightAngle) // The imaginary axis points down the screen
+	t := (real(u)*real(dir) + imag(u)*imag(dir) + c.LightHeight) / (1 + c.LightHeight)
+	return math.Max(0, t)
+}
+
+// shade darkens col by the brightness t in [0, 1].
+func shade(col color.Color, t float64) color.Color {
+	r, g, b, _ := col.RGBA()
+	return color.RGBA{uint8(float64(r>>8) * t), uint8(float64(g>>8) * t), uint8(float64(b>>8) * t), 255}
+}
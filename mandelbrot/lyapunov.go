@@ -0,0 +1,74 @@
+package mandelbrot
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strings"
+)
+
+// DefaultSequence is the default Lyapunov A/B sequence
+const DefaultSequence = "AB"
+
+// lyapunovWarmup is the number of iterations before the exponent is measured,
+// so the logistic map settles onto its attractor first.
+const lyapunovWarmup = 64
+
+// ParseSequence parses a Lyapunov sequence of A and B, such as "AABAB", into
+// a slice that is true for every B.
+func ParseSequence(s string) ([]bool, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" {
+		return nil, fmt.Errorf("sequence is empty")
+	}
+	seq := make([]bool, len(s))
+	for i, r := range s {
+		switch r {
+		case 'A':
+		case 'B':
+			seq[i] = true
+		default:
+			return nil, &SyntaxError{i + 1, fmt.Sprintf("sequence may only contain A and B, got %q", r)}
+		}
+	}
+	return seq, nil
+}
+
+// lyapunov computes the Lyapunov exponent of the logistic map
+// x = r*x*(1-x), with r taking the values a and b in the order of seq. The
+// exponent is returned in Point.Value; negative exponents are stable,
+// positive ones chaotic.
+func lyapunov(a, b float64, seq []bool, maxIter int) Point {
+	x := 0.5
+	r := func(i int) float64 {
+		if seq[i%len(seq)] {
+			return b
+		}
+		return a
+	}
+	for i := range lyapunovWarmup {
+		x = r(i) * x * (1 - x)
+	}
+
+	sum := 0.0
+	for i := range maxIter {
+		ri := r(lyapunovWarmup + i)
+		sum += math.Log(math.Abs(ri * (1 - 2*x)))
+		x = ri * x * (1 - x)
+	}
+	exponent := sum / float64(maxIter)
+	if math.IsNaN(exponent) {
+		exponent = math.Inf(1) // The orbit left [0, 1]
+	}
+	return Point{Iter: maxIter, Value: exponent}
+}
+
+// lyapunovColor colors stable regions (negative exponents) with the color
+// scheme and chaotic regions (positive exponents) in fading blue.
+func lyapunovColor(colors ColorParams, p Point) color.Color {
+	if p.Value >= 0 {
+		blue := 160 * math.Exp(-2*p.Value)
+		return color.RGBA{0, 0, uint8(blue), 255}
+	}
+	return colors.scheme(math.Min(1, -p.Value/2))
+}
@@ -0,0 +1,249 @@
+package mandelbrot
+
+import (
+	"context"
+	"image/color"
+	"math"
+)
+
+const (
+	// DefaultPower is the power of the classic Mandelbulb
+	DefaultPower = 8.0
+	// bulbIterations is the number of iterations of the distance estimator.
+	bulbIterations = 12
+	// bulbRadius bounds the Mandelbulb, rays that miss it are not marched.
+	bulbRadius = 1.5
+	// bulbFOV is the horizontal field of view, in radians.
+	bulbFOV = math.Pi / 3
+	// aoSamples is the number of ambient occlusion samples along the normal.
+	aoSamples = 5
+)
+
+// Camera places the viewer of the Mandelbulb: it looks at the target from
+// Distance away, turned around it by Yaw and Pitch (radians).
+type Camera struct {
+	TargetX, TargetY, TargetZ float64
+	Yaw, Pitch                float64
+	Distance                  float64
+}
+
+// DefaultCamera looks at the whole Mandelbulb from slightly above.
+func DefaultCamera() Camera {
+	return Camera{Yaw: 0.6, Pitch: 0.4, Distance: 4.5}
+}
+
+// vec3 is a point or direction in 3D space.
+type vec3 [3]float64
+
+func (a vec3) add(b vec3) vec3      { return vec3{a[0] + b[0], a[1] + b[1], a[2] + b[2]} }
+func (a vec3) sub(b vec3) vec3      { return vec3{a[0] - b[0], a[1] - b[1], a[2] - b[2]} }
+func (a vec3) scale(s float64) vec3 { return vec3{a[0] * s, a[1] * s, a[2] * s} }
+func (a vec3) dot(b vec3) float64   { return a[0]*b[0] + a[1]*b[1] + a[2]*b[2] }
+func (a vec3) length() float64      { return math.Sqrt(a.dot(a)) }
+func (a vec3) normalize() vec3      { return a.scale(1 / a.length()) }
+func (a vec3) cross(b vec3) vec3 {
+	return vec3{a[1]*b[2] - a[2]*b[1], a[2]*b[0] - a[0]*b[2], a[0]*b[1] - a[1]*b[0]}
+}
+
+// position returns where the camera is.
+func (c Camera) position() vec3 {
+	offset := vec3{
+		math.Cos(c.Pitch) * math.Sin(c.Yaw),
+		math.Sin(c.Pitch),
+		math.Cos(c.Pitch) * math.Cos(c.Yaw),
+	}
+	return c.target().add(offset.scale(c.Distance))
+}
+
+func (c Camera) target() vec3 {
+	return vec3{c.TargetX, c.TargetY, c.TargetZ}
+}
+
+// basis returns the forward, right and up directions of the camera.
+func (c Camera) basis() (forward, right, up vec3) {
+	forward = c.target().sub(c.position()).normalize()
+	right = forward.cross(vec3{0, 1, 0}).normalize()
+	up = right.cross(forward)
+	return forward, right, up
+}
+
+// Pan moves the target along the screen by dx, dy times the distance.
+func (c *Camera) Pan(dx, dy float64) {
+	_, right, up := c.basis()
+	t := c.target().add(right.scale(dx * c.Distance)).sub(up.scale(dy * c.Distance))
+	c.TargetX, c.TargetY, c.TargetZ = t[0], t[1], t[2]
+}
+
+// Rotate turns the camera around its target, keeping it from flipping over
+// the poles.
+func (c *Camera) Rotate(dyaw, dpitch float64) {
+	c.Yaw = math.Mod(c.Yaw+dyaw, 2*math.Pi)
+	c.Pitch = math.Max(-1.5, math.Min(1.5, c.Pitch+dpitch))
+}
+
+// bulbDE estimates the distance from p to the Mandelbulb of the given power,
+// also returning an orbit trap (the smallest |z|^2) used for coloring.
+func bulbDE(p vec3, power float64) (float64, float64) {
+	z := p
+	dr, r := 1.0, 0.0
+	trap := math.Inf(1)
+	for range bulbIterations {
+		r = z.length()
+		if r > 2 {
+			break
+		}
+		trap = math.Min(trap, r*r)
+
+		// Raise z to the power in spherical coordinates
+		theta := math.Acos(z[2]/r) * power
+		phi := math.Atan2(z[1], z[0]) * power
+		rn := math.Pow(r, power-1)
+		dr = rn*power*dr + 1
+		rn *= r
+		sinTheta := math.Sin(theta)
+		z = vec3{
+			rn * sinTheta * math.Cos(phi),
+			rn * sinTheta * math.Sin(phi),
+			rn * math.Cos(theta),
+		}.add(p)
+	}
+	if r == 0 {
+		return 0, trap
+	}
+	return 0.5 * math.Log(r) * r / dr, trap
+}
+
+// bulbRenderer marches rays from a camera into the Mandelbulb.
+type bulbRenderer struct {
+	power                 float64
+	maxSteps              int
+	origin                vec3
+	forward, right, up    vec3
+	width, height         int
+	halfWidth, halfHeight float64 // half the size of the image plane at distance 1
+	pixelAngle            float64
+	light                 vec3
+}
+
+func newBulbRenderer(params MandelbrotParams, width, height int) bulbRenderer {
+	cam := params.Camera
+	forward, right, up := cam.basis()
+	halfWidth := math.Tan(bulbFOV / 2)
+	aspectRatio := float64(params.Height) / float64(params.Width)
+	return bulbRenderer{
+		power:      params.Power,
+		maxSteps:   params.MaxIter,
+		origin:     cam.position(),
+		forward:    forward,
+		right:      right,
+		up:         up,
+		width:      width,
+		height:     height,
+		halfWidth:  halfWidth,
+		halfHeight: halfWidth * aspectRatio,
+		pixelAngle: 2 * halfWidth / float64(width),
+		// Light from above the left shoulder of the camera
+		light: up.scale(0.8).sub(right.scale(0.5)).sub(forward.scale(0.3)).normalize(),
+	}
+}
+
+// ray returns the direction of the ray through the center of pixel (x, y).
+func (b bulbRenderer) ray(x, y int) vec3 {
+	u := (2*(float64(x)+0.5)/float64(b.width) - 1) * b.halfWidth
+	v := (1 - 2*(float64(y)+0.5)/float64(b.height)) * b.halfHeight
+	return b.forward.add(b.right.scale(u)).add(b.up.scale(v)).normalize()
+}
+
+// trace marches the ray through pixel (x, y). Hits are marked as escaped,
+// with their shading in Value and the orbit trap in the real part of Z;
+// Iter holds the number of steps taken.
+func (b bulbRenderer) trace(x, y int) Point {
+	dir := b.ray(x, y)
+
+	// Only march inside the bounding sphere
+	oc := b.origin
+	half := oc.dot(dir)
+	disc := half*half - oc.dot(oc) + bulbRadius*bulbRadius
+	if disc < 0 {
+		return Point{}
+	}
+	t := math.Max(0, -half-math.Sqrt(disc))
+	far := -half + math.Sqrt(disc)
+
+	for i := range b.maxSteps {
+		p := b.origin.add(dir.scale(t))
+		d, trap := bulbDE(p, b.power)
+		if d < 0.5*b.pixelAngle*t {
+			return Point{Iter: i, Z: complex(trap, 0), Escaped: true, Value: b.shade(p, dir, t)}
+		}
+		t += d
+		if t > far {
+			return Point{Iter: i}
+		}
+	}
+	return Point{Iter: b.maxSteps}
+}
+
+// shade lights a surface point with soft diffuse lighting and ambient
+// occlusion, returning its brightness in [0, 1].
+func (b bulbRenderer) shade(p, dir vec3, t float64) float64 {
+	n := b.normal(p, math.Max(1e-6, 0.5*b.pixelAngle*t))
+	diffuse := 0.5 + 0.5*n.dot(b.light) // wrapped, so the shadow side isn't flat black
+	specular := math.Pow(math.Max(0, n.dot(b.light.sub(dir).normalize())), 32)
+
+	// Ambient occlusion: how much closer the surface is than the samples
+	// taken along the normal
+	occlusion, weight := 0.0, 1.0
+	for i := 1; i <= aoSamples; i++ {
+		h := 0.01 * float64(i*i)
+		d, _ := bulbDE(p.add(n.scale(h)), b.power)
+		occlusion += weight * math.Max(0, h-d)
+		weight *= 0.6
+	}
+	ao := math.Max(0, 1-4*occlusion)
+	return math.Min(1, (0.15+0.85*diffuse)*ao+0.3*specular)
+}
+
+// normal estimates the surface normal at p from the gradient of the distance
+// estimate, with the tetrahedron technique.
+func (b bulbRenderer) normal(p vec3, eps float64) vec3 {
+	k := [4]vec3{{1, -1, -1}, {-1, -1, 1}, {-1, 1, -1}, {1, 1, 1}}
+	var n vec3
+	for _, dir := range k {
+		d, _ := bulbDE(p.add(dir.scale(eps)), b.power)
+		n = n.add(dir.scale(d))
+	}
+	return n.normalize()
+}
+
+// renderMandelbulb ray marches the pixels inside regions of field.
+func renderMandelbulb(ctx context.Context, params MandelbrotParams, field *IterField, regions []tile) error {
+	b := newBulbRenderer(params, field.Width, field.Height)
+	for _, region := range regions {
+		err := forEachTile(ctx, region, params.Workers, func(t tile) {
+			for y := t.y0; y < t.y1; y++ {
+				if ctx.Err() != nil {
+					return
+				}
+				for x := t.x0; x < t.x1; x++ {
+					field.Points[y*field.Width+x] = b.trace(x, y)
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bulbColor colors Mandelbulb hits by their orbit trap, shaded by their
+// lighting, over a dark background.
+func bulbColor(colors ColorParams, p Point) color.Color {
+	if !p.Escaped {
+		return color.RGBA{10, 10, 20, 255}
+	}
+	t := real(p.Z)
+	t -= math.Floor(t)
+	return shade(colors.scheme(t), p.Value)
+}
@@ -0,0 +1,80 @@
+package mandelbrot
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+)
+
+// DefaultRoots are the roots of z^3 - 1
+const DefaultRoots = "1, -0.5+0.8660254i, -0.5-0.8660254i"
+
+// newtonTolerance is how close to a root an orbit has to get to converge.
+const newtonTolerance = 1e-6
+
+// maxRoots is the most roots a Newton polynomial may have.
+const maxRoots = 32
+
+// ParseRoots parses a comma separated list of constant expressions, such as
+// "1, -0.5+0.866i, -0.5-0.866i", into the roots of a Newton polynomial.
+func ParseRoots(s string) ([]complex128, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	var roots []complex128
+	for {
+		start := p.peek().pos
+		n, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		if !n.constant {
+			return nil, &SyntaxError{start, fmt.Sprintf("root %d is not a constant", len(roots)+1)}
+		}
+		roots = append(roots, n.eval(0, 0))
+		if !p.accept(",") {
+			break
+		}
+	}
+	if p.peek().kind != "end" {
+		return nil, p.unexpected(`expected ","`)
+	}
+	if len(roots) > maxRoots {
+		return nil, fmt.Errorf("at most %d roots are supported, got %d", maxRoots, len(roots))
+	}
+	return roots, nil
+}
+
+// newton runs Newton's method on the polynomial with the given roots from z
+// until it comes within newtonTolerance of one of them. Converged points are
+// marked as escaped, with the index of their root in Point.Root.
+func newton(z complex128, roots []complex128, maxIter int) Point {
+	for i := range maxIter {
+		// p'(z)/p(z) is the sum of 1/(z - root)
+		var sum complex128
+		for k, root := range roots {
+			d := z - root
+			if real(d)*real(d)+imag(d)*imag(d) < newtonTolerance*newtonTolerance {
+				return Point{Iter: i, Z: z, Escaped: true, Root: uint8(k)}
+			}
+			sum += 1 / d
+		}
+		if sum == 0 {
+			break // Critical point, Newton's method is stuck
+		}
+		z -= 1 / sum
+	}
+	return interior(maxIter, z)
+}
+
+// newtonColor colors a converged point by its root, darker the more
+// iterations it took.
+func newtonColor(colors ColorParams, p Point, roots int) color.Color {
+	if !p.Escaped {
+		return color.RGBA{0, 0, 0, 255}
+	}
+	t := (float64(p.Root) + 0.5) / float64(roots)
+	return shade(colors.scheme(t), math.Pow(0.95, float64(p.Iter)))
+}
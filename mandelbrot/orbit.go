@@ -0,0 +1,134 @@
+package mandelbrot
+
+import (
+	"image/color"
+	"math"
+	"math/cmplx"
+)
+
+// DefaultStripeDensity is the default frequency of stripe average coloring.
+const DefaultStripeDensity = 5.0
+
+// averageBailout is the escape radius of the average colorings. Their last
+// terms only settle far from the set, and with the usual radius of 2 the
+// bands of the interpolation show through.
+const averageBailout = 1e3
+
+// orbitStats accumulates a statistic over a whole orbit, for the colorings
+// that depend on more than where the orbit ends. The statistic ends up in
+// Point.Value.
+type orbitStats struct {
+	coloring      int
+	trap          OrbitTrap
+	stripeDensity float64
+	radius        float64 // Escape radius of the orbit
+	degree        float64 // Growth of |z| per iteration, for interpolating averages
+
+	min       float64 // Closest approach to the trap
+	sum, last float64 // Sum and last term of an average
+	terms     int
+}
+
+// newOrbitStats returns the statistic needed by the coloring of params, or
+// nil when it only needs the end of the orbit.
+func newOrbitStats(params MandelbrotParams) *orbitStats {
+	if !params.OrbitColoring() {
+		return nil
+	}
+	s := &orbitStats{
+		coloring:      params.Coloring,
+		trap:          params.Trap,
+		stripeDensity: params.StripeDensity,
+		radius:        2,
+		degree:        params.degree(),
+	}
+	if params.Coloring != ColoringOrbitTrap {
+		s.radius = averageBailout
+	}
+	return s
+}
+
+// OrbitColoring reports whether the coloring needs statistics of the whole
+// orbit. They are collected while rendering, so switching to or from such a
+// coloring needs a new render rather than a recolor.
+func (c ColorParams) OrbitColoring() bool {
+	switch c.Coloring {
+	case ColoringOrbitTrap, ColoringStripe, ColoringTriangle:
+		return true
+	}
+	return false
+}
+
+// bailout returns the squared escape radius of the orbit.
+func (s orbitStats) bailout() float64 {
+	return s.radius * s.radius
+}
+
+// start returns empty statistics for a new orbit.
+func (s orbitStats) start() orbitStats {
+	s.min = math.Inf(1)
+	return s
+}
+
+// add records the next point z of the orbit of c.
+func (s *orbitStats) add(z, c complex128) {
+	switch s.coloring {
+	case ColoringOrbitTrap:
+		s.min = math.Min(s.min, s.trap.distance(z))
+	case ColoringStripe:
+		s.addTerm(0.5 + 0.5*math.Sin(s.stripeDensity*cmplx.Phase(z)))
+	case ColoringTriangle:
+		// Where |z| lies between the bounds the triangle inequality gives
+		// for |z_prev^2 + c|, with |z_prev^2| = |z - c|
+		zPrev2, absC := cmplx.Abs(z-c), cmplx.Abs(c)
+		lo, hi := math.Abs(zPrev2-absC), zPrev2+absC
+		if hi > lo {
+			s.addTerm((cmplx.Abs(z) - lo) / (hi - lo))
+		}
+	}
+}
+
+func (s *orbitStats) addTerm(t float64) {
+	s.sum += t
+	s.last = t
+	s.terms++
+}
+
+// value returns the statistic of the orbit that ended in p. Averages of
+// escaped orbits are interpolated between the average with and without
+// the last term, by the fractional part of the smooth iteration count, so
+// they are continuous across iteration bands.
+func (s *orbitStats) value(p Point) float64 {
+	if s.coloring == ColoringOrbitTrap {
+		return s.min
+	}
+	if s.terms == 0 {
+		return 0
+	}
+	avg := s.sum / float64(s.terms)
+	if !p.Escaped || s.terms < 2 {
+		return avg
+	}
+	prev := (s.sum - s.last) / float64(s.terms-1)
+	return prev + smoothFraction(cmplx.Abs(p.Z), s.radius, s.degree)*(avg-prev)
+}
+
+// smoothFraction returns how far an orbit that escaped past radius with
+// magnitude absZ got into its last iteration, in [0, 1].
+func smoothFraction(absZ, radius, degree float64) float64 {
+	f := 1 + math.Log(math.Log(radius)/math.Log(absZ))/math.Log(degree)
+	if math.IsNaN(f) {
+		return 1
+	}
+	return math.Max(0, math.Min(1, f))
+}
+
+// averageColor colors escaped points by the stripe or triangle inequality
+// average of their orbit, which lies in [0, 1].
+func averageColor(colors ColorParams, p Point) color.Color {
+	if !p.Escaped {
+		return color.RGBA{0, 0, 0, 255}
+	}
+	t := math.Max(0, math.Min(1, p.Value))
+	return colors.scheme(t)
+}
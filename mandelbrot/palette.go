@@ -0,0 +1,443 @@
+package mandelbrot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Palette is a color scheme defined by color stops, interpolated in RGB or
+// OKLab. Every color scheme is a palette, see RegisterPalette.
+type Palette struct {
+	Name  string
+	Stops []ColorStop
+	Cubic bool // Cubic instead of linear interpolation between stops
+	OKLab bool // Interpolate in OKLab instead of sRGB
+
+	points []vec3 // Stops converted to the interpolation space
+}
+
+// ColorStop is the color of a palette at position Pos in [0, 1].
+type ColorStop struct {
+	Pos   float64
+	Color color.RGBA
+}
+
+// palettes are the registered palettes, color scheme i is palettes[i].
+var palettes []Palette
+
+// Built-in palettes, the schemes with a ColorMode constant first and in its
+// order, then the gradients
+func init() {
+	rgb := func(r, g, b uint8) color.RGBA { return color.RGBA{r, g, b, 255} }
+	hues := []color.RGBA{
+		rgb(255, 0, 0), rgb(255, 255, 0), rgb(0, 255, 0),
+		rgb(0, 255, 255), rgb(0, 0, 255), rgb(255, 0, 255),
+	}
+	var psychedelic []color.RGBA
+	for range 5 {
+		psychedelic = append(psychedelic, hues...)
+	}
+
+	builtin := [ColorModeCount]Palette{
+		ColorGrayscale: {Name: "Grayscale", Stops: evenStops(rgb(255, 255, 255), rgb(0, 0, 0))},
+		ColorNebula: {Name: "Nebula", Stops: evenStops(
+			rgb(82, 82, 204), rgb(204, 78, 204), rgb(204, 75, 109), rgb(204, 71, 71), rgb(204, 68, 104),
+			rgb(204, 65, 204), rgb(61, 61, 204), rgb(58, 204, 204), rgb(54, 204, 94), rgb(51, 204, 51),
+			rgb(48, 204, 90), rgb(44, 204, 204), rgb(41, 41, 204), rgb(204, 37, 204), rgb(204, 34, 80),
+			rgb(204, 31, 31), rgb(204, 27, 75), rgb(204, 24, 204), rgb(20, 20, 204), rgb(17, 204, 204),
+			rgb(14, 204, 65), rgb(10, 204, 10), rgb(7, 204, 60), rgb(3, 204, 204), rgb(0, 0, 204),
+		)},
+		ColorRainbow: {Name: "Rainbow", Stops: evenStops(append(hues, hues[0])...)},
+		ColorFire:    {Name: "Fire", Stops: evenStops(rgb(0, 0, 0), rgb(255, 0, 0), rgb(255, 255, 0), rgb(255, 255, 255))},
+		ColorOcean: {Name: "Ocean", Stops: []ColorStop{
+			{0, rgb(0, 0, 51)},
+			{0.5, rgb(0, 0, 178)},
+			{2.0 / 3, rgb(0, 85, 221)},
+			{0.8, rgb(102, 153, 255)},
+			{1, rgb(255, 255, 255)},
+		}},
+		ColorPsychedelic: {Name: "Psychedelic", Stops: evenStops(append(psychedelic, hues[0])...)},
+		ColorIce:         {Name: "Ice", Stops: evenStops(rgb(0, 0, 100), rgb(0, 200, 255))},
+		ColorInferno: {Name: "Inferno", Stops: evenStops(
+			rgb(0, 0, 255), rgb(128, 4, 171), rgb(255, 12, 108), rgb(255, 23, 62), rgb(255, 35, 32),
+			rgb(255, 49, 13), rgb(255, 65, 4), rgb(255, 82, 0), rgb(255, 100, 0),
+		)},
+		ColorDesert: {Name: "Desert", Stops: evenStops(rgb(0, 200, 100), rgb(255, 0, 200))},
+		ColorForest: {Name: "Forest", Stops: evenStops(rgb(80, 100, 30), rgb(30, 255, 50))},
+	}
+	gradients := []Palette{{
+		Name:  "Classic",
+		Cubic: true,
+		Stops: []ColorStop{
+			{0, rgb(0, 7, 100)},
+			{0.16, rgb(32, 107, 203)},
+			{0.42, rgb(237, 255, 255)},
+			{0.6425, rgb(255, 170, 0)},
+			{0.8575, rgb(0, 2, 0)},
+			{1, rgb(0, 7, 100)},
+		},
+	}, {
+		Name:  "Sunset",
+		OKLab: true,
+		Stops: []ColorStop{
+			{0, rgb(26, 11, 59)},
+			{0.35, rgb(180, 40, 110)},
+			{0.7, rgb(255, 123, 0)},
+			{1, rgb(255, 243, 176)},
+		},
+	}}
+	for _, p := range append(builtin[:], gradients...) {
+		if _, err := RegisterPalette(p); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// evenStops spreads colors evenly over [0, 1].
+func evenStops(colors ...color.RGBA) []ColorStop {
+	stops := make([]ColorStop, len(colors))
+	for i, c := range colors {
+		stops[i] = ColorStop{float64(i) / float64(len(colors)-1), c}
+	}
+	return stops
+}
+
+// RegisterPalette adds a palette to the color schemes and returns its index.
+// Names are unique regardless of case, so SchemeIndex finds every palette.
+// Palettes are registered at startup, before anything renders: renders read
+// them without locking.
+func RegisterPalette(p Palette) (int, error) {
+	if _, ok := SchemeIndex(p.Name); ok {
+		return 0, fmt.Errorf("a color scheme named %q already exists", p.Name)
+	}
+	scheme := len(palettes)
+	p.points = make([]vec3, len(p.Stops))
+	for i, s := range p.Stops {
+		p.points[i] = p.toSpace(s.Color)
+	}
+	palettes = append(palettes, p)
+	ColorNames[scheme] = p.Name
+	return scheme, nil
+}
+
+// SchemeCount returns the number of color schemes.
+func SchemeCount() int {
+	return len(palettes)
+}
+
+// SchemeIndex returns the color scheme with the given name.
+func SchemeIndex(name string) (int, bool) {
+	for i := range SchemeCount() {
+		if strings.EqualFold(ColorNames[i], name) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// At returns the color of the palette at position t in [0, 1].
+func (p Palette) At(t float64) color.Color {
+	stops := p.Stops
+	if len(stops) == 0 {
+		return color.RGBA{0, 0, 0, 255}
+	}
+	// Index of the first stop after t
+	i := sort.Search(len(stops), func(i int) bool { return stops[i].Pos > t })
+	if i == 0 {
+		return stops[0].Color
+	}
+	if i == len(stops) {
+		return stops[len(stops)-1].Color
+	}
+
+	a, b := stops[i-1], stops[i]
+	width := b.Pos - a.Pos
+	if width <= 0 {
+		return b.Color
+	}
+	s := (t - a.Pos) / width
+	if !p.Cubic {
+		return p.fromSpace(p.point(i - 1).scale(1 - s).add(p.point(i).scale(s)))
+	}
+
+	// Cubic Hermite spline with Catmull-Rom tangents, which handle unevenly
+	// spaced stops
+	tangent := func(j int) vec3 {
+		lo, hi := max(j-1, 0), min(j+1, len(stops)-1)
+		d := stops[hi].Pos - stops[lo].Pos
+		if d <= 0 {
+			return vec3{}
+		}
+		return p.point(hi).sub(p.point(lo)).scale(width / d)
+	}
+	s2, s3 := s*s, s*s*s
+	c := p.point(i - 1).scale(2*s3 - 3*s2 + 1).
+		add(tangent(i - 1).scale(s3 - 2*s2 + s)).
+		add(p.point(i).scale(-2*s3 + 3*s2)).
+		add(tangent(i).scale(s3 - s2))
+	return p.fromSpace(c)
+}
+
+// point returns stop i in the interpolation space.
+func (p Palette) point(i int) vec3 {
+	if len(p.points) == len(p.Stops) {
+		return p.points[i]
+	}
+	return p.toSpace(p.Stops[i].Color)
+}
+
+// toSpace converts a color to the interpolation space of the palette.
+func (p Palette) toSpace(c color.RGBA) vec3 {
+	rgb := vec3{float64(c.R) / 255, float64(c.G) / 255, float64(c.B) / 255}
+	if p.OKLab {
+		return rgbToOKLab(rgb)
+	}
+	return rgb
+}
+
+// fromSpace converts back from the interpolation space, clamping to sRGB.
+func (p Palette) fromSpace(c vec3) color.Color {
+	if p.OKLab {
+		c = okLabToRGB(c)
+	}
+	channel := func(v float64) uint8 {
+		return uint8(math.Round(255 * math.Max(0, math.Min(1, v))))
+	}
+	return color.RGBA{channel(c[0]), channel(c[1]), channel(c[2]), 255}
+}
+
+// rgbToOKLab converts sRGB in [0, 1] to OKLab.
+func rgbToOKLab(c vec3) vec3 {
+	r, g, b := srgbToLinear(c[0]), srgbToLinear(c[1]), srgbToLinear(c[2])
+	l := math.Cbrt(0.4122214708*r + 0.5363325363*g + 0.0514459929*b)
+	m := math.Cbrt(0.2119034982*r + 0.6806995451*g + 0.1073969566*b)
+	s := math.Cbrt(0.0883024619*r + 0.2817188376*g + 0.6299787005*b)
+	return vec3{
+		0.2104542553*l + 0.7936177850*m - 0.0040720468*s,
+		1.9779984951*l - 2.4285922050*m + 0.4505937099*s,
+		0.0259040371*l + 0.7827717662*m - 0.8086757660*s,
+	}
+}
+
+// okLabToRGB converts OKLab to sRGB, which may fall outside [0, 1].
+func okLabToRGB(c vec3) vec3 {
+	l := c[0] + 0.3963377774*c[1] + 0.2158037573*c[2]
+	m := c[0] - 0.1055613458*c[1] - 0.0638541728*c[2]
+	s := c[0] - 0.0894841775*c[1] - 1.2914855480*c[2]
+	l, m, s = l*l*l, m*m*m, s*s*s
+	return vec3{
+		linearToSRGB(4.0767416621*l - 3.3077115913*m + 0.2309699292*s),
+		linearToSRGB(-1.2684380046*l + 2.6097574011*m - 0.3413193965*s),
+		linearToSRGB(-0.0041960863*l - 0.7034186147*m + 1.7076147010*s),
+	}
+}
+
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return 12.92 * v
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// paletteFile is the JSON or TOML form of a palette:
+//
+//	{
+//	  "name": "Sunset",
+//	  "interpolation": "cubic",
+//	  "space": "oklab",
+//	  "stops": [{"pos": 0, "color": "#1a0b3b"}, {"color": "#ff7b00"}, ...]
+//	}
+//
+// or
+//
+//	name = "Sunset"
+//	interpolation = "cubic"
+//	space = "oklab"
+//
+//	[[stops]]
+//	pos = 0
+//	color = "#1a0b3b"
+//
+//	[[stops]]
+//	color = "#ff7b00"
+//
+// Interpolation is "linear" (default) or "cubic", space is "rgb" (default) or
+// "oklab". Stops without a position are spread evenly between their
+// neighbours.
+type paletteFile struct {
+	Name          string `json:"name" toml:"name"`
+	Interpolation string `json:"interpolation" toml:"interpolation"`
+	Space         string `json:"space" toml:"space"`
+	Stops         []struct {
+		Pos   *float64 `json:"pos" toml:"pos"`
+		Color string   `json:"color" toml:"color"`
+	} `json:"stops" toml:"stops"`
+}
+
+// ParsePalette reads a palette from JSON, named name unless it has a name.
+func ParsePalette(data []byte, name string) (Palette, error) {
+	var f paletteFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return Palette{}, err
+	}
+	return f.palette(name)
+}
+
+// ParsePaletteTOML reads a palette from TOML, named name unless it has a
+// name.
+func ParsePaletteTOML(data []byte, name string) (Palette, error) {
+	var f paletteFile
+	if err := toml.Unmarshal(data, &f); err != nil {
+		return Palette{}, err
+	}
+	return f.palette(name)
+}
+
+// palette checks f and converts it to a palette.
+func (f paletteFile) palette(name string) (Palette, error) {
+	p := Palette{Name: f.Name}
+	if p.Name == "" {
+		p.Name = name
+	}
+
+	switch strings.ToLower(f.Interpolation) {
+	case "", "linear":
+	case "cubic":
+		p.Cubic = true
+	default:
+		return Palette{}, fmt.Errorf("unknown interpolation %q", f.Interpolation)
+	}
+	switch strings.ToLower(f.Space) {
+	case "", "rgb", "srgb":
+	case "oklab":
+		p.OKLab = true
+	default:
+		return Palette{}, fmt.Errorf("unknown color space %q", f.Space)
+	}
+
+	if len(f.Stops) < 2 {
+		return Palette{}, errors.New("a palette needs at least 2 stops")
+	}
+	p.Stops = make([]ColorStop, len(f.Stops))
+	known := make([]bool, len(f.Stops))
+	for i, s := range f.Stops {
+		c, err := parseHexColor(s.Color)
+		if err != nil {
+			return Palette{}, err
+		}
+		p.Stops[i].Color = c
+		if s.Pos != nil {
+			if *s.Pos < 0 || *s.Pos > 1 {
+				return Palette{}, fmt.Errorf("stop position %v is outside [0, 1]", *s.Pos)
+			}
+			p.Stops[i].Pos, known[i] = *s.Pos, true
+		}
+	}
+	spreadStops(p.Stops, known)
+	for i := 1; i < len(p.Stops); i++ {
+		if p.Stops[i].Pos < p.Stops[i-1].Pos {
+			return Palette{}, errors.New("stop positions must be increasing")
+		}
+	}
+	return p, nil
+}
+
+// spreadStops places the stops without a known position evenly between the
+// known ones. The first and last stop default to 0 and 1.
+func spreadStops(stops []ColorStop, known []bool) {
+	last := len(stops) - 1
+	if !known[0] {
+		stops[0].Pos, known[0] = 0, true
+	}
+	if !known[last] {
+		stops[last].Pos, known[last] = 1, true
+	}
+	prev := 0
+	for i := 1; i <= last; i++ {
+		if !known[i] {
+			continue
+		}
+		for j := prev + 1; j < i; j++ {
+			f := float64(j-prev) / float64(i-prev)
+			stops[j].Pos = stops[prev].Pos + f*(stops[i].Pos-stops[prev].Pos)
+		}
+		prev = i
+	}
+}
+
+// parseHexColor parses a #rrggbb or #rgb color.
+func parseHexColor(s string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 6 || err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+	return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 255}, nil
+}
+
+// PaletteDir returns the directory user palettes are loaded from.
+func PaletteDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "mandel-cli", "palettes"), nil
+}
+
+// LoadPalettes registers every *.json and *.toml palette in dir, in file name
+// order. A missing directory is not an error; broken files are skipped and
+// reported.
+func LoadPalettes(dir string) error {
+	var files []string
+	for _, pattern := range []string{"*.json", "*.toml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+	var errs []error
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		ext := filepath.Ext(file)
+		name := strings.TrimSuffix(filepath.Base(file), ext)
+		parse := ParsePalette
+		if ext == ".toml" {
+			parse = ParsePaletteTOML
+		}
+		p, err := parse(data, name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("palette %s: %w", filepath.Base(file), err))
+			continue
+		}
+		if _, err := RegisterPalette(p); err != nil {
+			errs = append(errs, fmt.Errorf("palette %s: %w", filepath.Base(file), err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,242 @@
+package mandelbrot
+
+import (
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParsePalette(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		toml string
+		want []float64 // Stop positions
+	}{
+		{
+			"ends default to 0 and 1",
+			`{"stops": [{"color": "#000"}, {"color": "#fff"}]}`,
+			"[[stops]]\ncolor = '#000'\n[[stops]]\ncolor = '#fff'",
+			[]float64{0, 1},
+		},
+		{
+			"spread between ends",
+			`{"stops": [{"color": "#000"}, {"color": "#000"}, {"color": "#000"}, {"color": "#fff"}]}`,
+			"stops = [{color = '#000'}, {color = '#000'}, {color = '#000'}, {color = '#fff'}]",
+			[]float64{0, 1.0 / 3, 2.0 / 3, 1},
+		},
+		{
+			"spread around known stops",
+			`{"stops": [{"pos": 0.2, "color": "#000"}, {"color": "#000"}, {"pos": 0.6, "color": "#000"}, {"color": "#000"}, {"color": "#fff"}]}`,
+			"stops = [{pos = 0.2, color = '#000'}, {color = '#000'}, {pos = 0.6, color = '#000'}, {color = '#000'}, {color = '#fff'}]",
+			[]float64{0.2, 0.4, 0.6, 0.8, 1},
+		},
+		{
+			"integer positions",
+			`{"stops": [{"pos": 0, "color": "#000"}, {"pos": 1, "color": "#fff"}]}`,
+			"stops = [{pos = 0, color = '#000'}, {pos = 1, color = '#fff'}]",
+			[]float64{0, 1},
+		},
+	}
+	for _, tt := range tests {
+		for _, format := range []string{"json", "toml"} {
+			t.Run(tt.name+"/"+format, func(t *testing.T) {
+				p, err := parsePaletteAs(format, tt.json, tt.toml)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var got []float64
+				for _, s := range p.Stops {
+					got = append(got, s.Pos)
+				}
+				if !slices.EqualFunc(got, tt.want, func(a, b float64) bool { return math.Abs(a-b) < 1e-12 }) {
+					t.Errorf("positions %v, want %v", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestParsePaletteFields(t *testing.T) {
+	const (
+		js = `{"name": "Dusk", "interpolation": "Cubic", "space": "OKLab", "stops": [{"color": "#1a0b3b"}, {"color": "#F80"}]}`
+		tm = `
+name = "Dusk"
+interpolation = "Cubic"
+space = "OKLab"
+
+[[stops]]
+color = "#1a0b3b"
+
+[[stops]]
+color = "#F80" # Short form
+`
+	)
+	for _, format := range []string{"json", "toml"} {
+		p, err := parsePaletteAs(format, js, tm)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if p.Name != "Dusk" || !p.Cubic || !p.OKLab {
+			t.Errorf("%s: got name %q, cubic %v, oklab %v", format, p.Name, p.Cubic, p.OKLab)
+		}
+		want := []color.RGBA{{0x1a, 0x0b, 0x3b, 255}, {0xff, 0x88, 0x00, 255}}
+		if p.Stops[0].Color != want[0] || p.Stops[1].Color != want[1] {
+			t.Errorf("%s: got colors %v, %v, want %v", format, p.Stops[0].Color, p.Stops[1].Color, want)
+		}
+	}
+
+	p, err := ParsePalette([]byte(`{"stops": [{"color": "#000"}, {"color": "#fff"}]}`), "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "file" || p.Cubic || p.OKLab {
+		t.Errorf("defaults: got name %q, cubic %v, oklab %v", p.Name, p.Cubic, p.OKLab)
+	}
+}
+
+func TestParsePaletteErrors(t *testing.T) {
+	tests := []struct {
+		json string
+		toml string
+		want string
+	}{
+		{
+			`{"stops": [{"color": "#000"}]}`,
+			"stops = [{color = '#000'}]",
+			"a palette needs at least 2 stops",
+		},
+		{
+			`{"stops": [{"color": "#00000"}, {"color": "#fff"}]}`,
+			"stops = [{color = '#00000'}, {color = '#fff'}]",
+			`invalid color "#00000"`,
+		},
+		{
+			`{"stops": [{"color": "#00000g"}, {"color": "#fff"}]}`,
+			"stops = [{color = '#00000g'}, {color = '#fff'}]",
+			`invalid color "#00000g"`,
+		},
+		{
+			`{"stops": [{"color": "black"}, {"color": "#fff"}]}`,
+			"stops = [{color = 'black'}, {color = '#fff'}]",
+			`invalid color "black"`,
+		},
+		{
+			`{"stops": [{"pos": -0.1, "color": "#000"}, {"color": "#fff"}]}`,
+			"stops = [{pos = -0.1, color = '#000'}, {color = '#fff'}]",
+			"stop position -0.1 is outside [0, 1]",
+		},
+		{
+			`{"stops": [{"color": "#000"}, {"pos": 1.5, "color": "#fff"}]}`,
+			"stops = [{color = '#000'}, {pos = 1.5, color = '#fff'}]",
+			"stop position 1.5 is outside [0, 1]",
+		},
+		{
+			`{"stops": [{"pos": 0.6, "color": "#000"}, {"pos": 0.4, "color": "#fff"}]}`,
+			"stops = [{pos = 0.6, color = '#000'}, {pos = 0.4, color = '#fff'}]",
+			"stop positions must be increasing",
+		},
+		{
+			// The unplaced last stop defaults to 1, before the first one
+			`{"stops": [{"pos": 1, "color": "#000"}, {"pos": 0.5, "color": "#000"}, {"color": "#fff"}]}`,
+			"stops = [{pos = 1, color = '#000'}, {pos = 0.5, color = '#000'}, {color = '#fff'}]",
+			"stop positions must be increasing",
+		},
+		{
+			`{"interpolation": "bezier", "stops": [{"color": "#000"}, {"color": "#fff"}]}`,
+			"interpolation = 'bezier'\nstops = [{color = '#000'}, {color = '#fff'}]",
+			`unknown interpolation "bezier"`,
+		},
+		{
+			`{"space": "hsv", "stops": [{"color": "#000"}, {"color": "#fff"}]}`,
+			"space = 'hsv'\nstops = [{color = '#000'}, {color = '#fff'}]",
+			`unknown color space "hsv"`,
+		},
+	}
+	for _, tt := range tests {
+		for _, format := range []string{"json", "toml"} {
+			_, err := parsePaletteAs(format, tt.json, tt.toml)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("%s %s: got error %v, want %q", format, tt.json, err, tt.want)
+			}
+		}
+	}
+
+	// Syntax errors come from the decoders
+	if _, err := ParsePalette([]byte(`{"stops": [`), "x"); err == nil {
+		t.Error("truncated JSON: no error")
+	}
+	if _, err := ParsePaletteTOML([]byte("stops = [{color = '#000'}"), "x"); err == nil {
+		t.Error("truncated TOML: no error")
+	}
+}
+
+func TestLoadPalettes(t *testing.T) {
+	keepPalettes(t)
+	dir := t.TempDir()
+	files := map[string]string{
+		"dusk.json":  `{"stops": [{"color": "#000"}, {"color": "#fff"}]}`,
+		"dusk.toml":  "stops = [{color = '#000'}, {color = '#fff'}]",
+		"fire.toml":  "name = 'FIRE'\nstops = [{color = '#000'}, {color = '#fff'}]",
+		"mist.toml":  "stops = [{color = '#000'}, {color = '#fff'}]",
+		"storm.json": `{"stops": [{"color": "#000"}]}`,
+		"notes.txt":  "not a palette",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	count := SchemeCount()
+	err := LoadPalettes(dir)
+	if err == nil {
+		t.Fatal("no error")
+	}
+	got := strings.Split(err.Error(), "\n")
+	want := []string{
+		`palette dusk.toml: a color scheme named "dusk" already exists`,
+		`palette fire.toml: a color scheme named "FIRE" already exists`,
+		"palette storm.json: a palette needs at least 2 stops",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got errors\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// The good files are registered, in file name order
+	if SchemeCount() != count+2 {
+		t.Fatalf("registered %d palettes, want 2", SchemeCount()-count)
+	}
+	for i, name := range []string{"dusk", "mist"} {
+		if got, ok := SchemeIndex(name); !ok || got != count+i {
+			t.Errorf("SchemeIndex(%q) = %d, %v, want %d", name, got, ok, count+i)
+		}
+	}
+
+	if err := LoadPalettes(filepath.Join(dir, "missing")); err != nil {
+		t.Errorf("missing directory: %v", err)
+	}
+}
+
+// parsePaletteAs parses the JSON or TOML form of a palette, named "test".
+func parsePaletteAs(format, js, tm string) (Palette, error) {
+	if format == "toml" {
+		return ParsePaletteTOML([]byte(tm), "test")
+	}
+	return ParsePalette([]byte(js), "test")
+}
+
+// keepPalettes drops the palettes registered by the test when it ends.
+func keepPalettes(t *testing.T) {
+	count := SchemeCount()
+	t.Cleanup(func() {
+		for i := count; i < SchemeCount(); i++ {
+			delete(ColorNames, i)
+		}
+		palettes = palettes[:count]
+	})
+}
@@ -0,0 +1,121 @@
+package mandelbrot
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"sync"
+)
+
+// panTolerance is how far from a whole pixel a pan may be and still reuse the cache.
+const panTolerance = 1e-6
+
+// IterCache keeps the last full-resolution field of a render target, so
+// panning by whole pixels only computes the newly exposed strip. It is safe
+// for concurrent use.
+type IterCache struct {
+	mu     sync.Mutex
+	params MandelbrotParams
+	field  *IterField // never modified once stored
+}
+
+type cacheKey struct{}
+
+// WithCache returns a context that makes every render started with it reuse
+// and update cache.
+func WithCache(ctx context.Context, cache *IterCache) context.Context {
+	return context.WithValue(ctx, cacheKey{}, cache)
+}
+
+// cacheFrom returns the cache attached to ctx, or nil.
+func cacheFrom(ctx context.Context) *IterCache {
+	cache, _ := ctx.Value(cacheKey{}).(*IterCache)
+	return cache
+}
+
+// store remembers a finished full-resolution field.
+func (c *IterCache) store(params MandelbrotParams, field *IterField) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.params, c.field = params, field
+}
+
+// pan returns a new field for params holding the cached pixels shifted into
+// place, plus the regions that still have to be computed. ok is false when
+// the view changed in any way other than a pan by whole pixels.
+func (c *IterCache) pan(params MandelbrotParams, width, height int) (field *IterField, missing []tile, ok bool) {
+	if c == nil {
+		return nil, nil, false
+	}
+	if params.Fractal == FractalMandelbulb {
+		return nil, nil, false // The center doesn't move a 3D view
+	}
+	c.mu.Lock()
+	prev, prevField := c.params, c.field
+	c.mu.Unlock()
+	if prevField == nil || prevField.Width != width || prevField.Height != height || !sameExceptCenter(prev, params) {
+		return nil, nil, false
+	}
+
+	view := newViewport(params, width, height)
+	dx, okX := pixelShift(params.CenterRe, prev.CenterRe, view.deltaRe)
+	dy, okY := pixelShift(params.CenterIm, prev.CenterIm, view.deltaIm)
+	if !okX || !okY || abs(dx) >= width || abs(dy) >= height {
+		return nil, nil, false
+	}
+
+	// Pixel (x, y) of the new view is pixel (x+dx, y+dy) of the old one
+	field = newIterField(width, height, params.MaxIter)
+	for y := max(0, -dy); y < min(height, height-dy); y++ {
+		copy(field.Points[y*width+max(0, -dx):y*width+min(width, width-dx)],
+			prevField.Points[(y+dy)*width+max(0, dx):(y+dy)*width+min(width, width+dx)])
+	}
+
+	if dy > 0 {
+		missing = append(missing, tile{0, height - dy, width, height})
+	} else if dy < 0 {
+		missing = append(missing, tile{0, 0, width, -dy})
+	}
+	rows := tile{0, max(0, -dy), width, min(height, height-dy)}
+	if dx > 0 {
+		missing = append(missing, tile{width - dx, rows.y0, width, rows.y1})
+	} else if dx < 0 {
+		missing = append(missing, tile{0, rows.y0, -dx, rows.y1})
+	}
+	return field, missing, true
+}
+
+// sameExceptCenter reports whether a and b describe the same field apart
+// from the position of the center. Of the color settings only the algorithm
+// matters, as it decides the orbit statistics held by the field, and whether
+// the field carries derivatives.
+func sameExceptCenter(a, b MandelbrotParams) bool {
+	return a.ZoomFactor == b.ZoomFactor && a.MaxIter == b.MaxIter &&
+		a.Width == b.Width && a.Height == b.Height &&
+		a.Fractal == b.Fractal && a.JuliaRe == b.JuliaRe && a.JuliaIm == b.JuliaIm &&
+		a.Formula == b.Formula && a.Exponent == b.Exponent &&
+		a.Expression == b.Expression && a.Bailout == b.Bailout &&
+		a.Roots == b.Roots && a.Sequence == b.Sequence &&
+		a.Engine == b.Engine && a.SeriesApprox == b.SeriesApprox && a.SeriesTerms == b.SeriesTerms &&
+		a.Subdivide == b.Subdivide && a.ColorParams.flatFill() == b.ColorParams.flatFill() &&
+		a.ColorParams.needsDeriv() == b.ColorParams.needsDeriv() &&
+		a.Coloring == b.Coloring && a.Trap == b.Trap && a.StripeDensity == b.StripeDensity
+}
+
+// pixelShift returns (to - from) in whole pixels of the given size.
+func pixelShift(to, from *big.Float, pixel float64) (int, bool) {
+	d, _ := new(big.Float).Sub(to, from).Float64()
+	shift := d / pixel
+	rounded := math.Round(shift)
+	return int(rounded), math.Abs(shift-rounded) < panTolerance
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,220 @@
+package mandelbrot
+
+import (
+	"context"
+	"math/big"
+	"slices"
+	"sync"
+)
+
+const (
+	// glitchTolerance is Pauldelbrot's threshold: a pixel is glitched once
+	// |Z+dz| drops below this fraction of |Z|.
+	glitchTolerance = 1e-3
+	// maxReferences caps how many reference orbits a single frame may use.
+	maxReferences = 16
+)
+
+// referenceOrbit is a high-precision orbit rounded to float64 for perturbation.
+type referenceOrbit struct {
+	z            []complex128 // Z_0 = 0, Z_1 = C, ... up to escape or maxIter
+	offRe, offIm float64      // offset of C from the view center
+}
+
+// computeReferenceOrbit iterates the reference point at the view precision.
+func computeReferenceOrbit(ctx context.Context, view viewport, offRe, offIm float64, maxIter int) (referenceOrbit, error) {
+	cRe := addOffset(view.centerRe, offRe, view.prec).SetPrec(view.prec)
+	cIm := addOffset(view.centerIm, offIm, view.prec).SetPrec(view.prec)
+	zRe := new(big.Float).SetPrec(view.prec)
+	zIm := new(big.Float).SetPrec(view.prec)
+	zRe2 := new(big.Float).SetPrec(view.prec)
+	zIm2 := new(big.Float).SetPrec(view.prec)
+	tmp := new(big.Float).SetPrec(view.prec)
+
+	orbit := referenceOrbit{z: make([]complex128, 1, maxIter+1), offRe: offRe, offIm: offIm}
+	for i := range maxIter {
+		if i%1024 == 0 && ctx.Err() != nil {
+			return orbit, ctx.Err()
+		}
+		tmp.Mul(zRe, zIm)
+		zIm.Add(tmp, tmp)
+		zIm.Add(zIm, cIm)
+		zRe.Sub(zRe2, zIm2)
+		zRe.Add(zRe, cRe)
+		zRe2.Mul(zRe, zRe)
+		zIm2.Mul(zIm, zIm)
+		re, _ := zRe.Float64()
+		im, _ := zIm.Float64()
+		orbit.z = append(orbit.z, complex(re, im))
+		if re*re+im*im > 4 {
+			break
+		}
+	}
+	return orbit, nil
+}
+
+// perturb iterates the delta of pixel (x, y) against the reference orbit,
+// starting where the series approximation leaves off. Pixels that outlive the
+// reference are rebased onto its start, Z_0 = 0, so an escaping reference is
+// fine. It reports glitched when the result cannot be trusted and a new
+// reference is needed.
+func (o referenceOrbit) perturb(view viewport, series seriesApproximation, x, y, maxIter int) (p Point, glitched bool) {
+	dRe, dIm := view.offset(x, y)
+	dc := complex(dRe-o.offRe, dIm-o.offIm)
+	dz := series.at(dc)
+	var deriv complex128 // dz/dc of the full orbit
+	if view.derivs {
+		deriv = series.derivAt(dc)
+	}
+	var stats orbitStats
+	bailout := 4.0
+	if view.stats != nil {
+		stats = view.stats.start()
+		bailout = stats.bailout()
+	}
+	ref := series.skip // index into the reference orbit
+	for i := series.skip; i < maxIter; i++ {
+		if ref+1 >= len(o.z) {
+			// Continue from the start of the reference with the full z
+			dz, ref = o.z[ref]+dz, 0
+		}
+		if view.derivs {
+			deriv = 2*(o.z[ref]+dz)*deriv + 1
+		}
+		dz = 2*o.z[ref]*dz + dz*dz + dc
+		ref++
+		z := o.z[ref] + dz
+		if view.stats != nil {
+			stats.add(z, complex(view.re+dRe, view.im+dIm))
+		}
+		mag := real(z)*real(z) + imag(z)*imag(z)
+		if mag > bailout {
+			p := escapedDeriv(i, z, deriv)
+			p.Value = stats.value(p)
+			return p, false
+		}
+		zRef := o.z[ref]
+		if mag < glitchTolerance*glitchTolerance*(real(zRef)*real(zRef)+imag(zRef)*imag(zRef)) {
+			return Point{}, true
+		}
+	}
+	p = interior(maxIter, o.z[ref]+dz)
+	p.Value = stats.value(p)
+	return p, false
+}
+
+// reference is the reference orbit at the view center with its series
+// approximation. The passes of a progressive render share one, since a
+// coarser pass of the same view has no pixels outside the full-resolution
+// probes the series was checked at.
+type reference struct {
+	orbit  referenceOrbit
+	series seriesApproximation
+}
+
+// usesPerturbation reports whether params render with the perturbation engine.
+func usesPerturbation(params MandelbrotParams) bool {
+	return params.Engine == EnginePerturbation && params.Fractal == FractalMandelbrot && params.Formula == FormulaQuadratic
+}
+
+// computeReference computes the reference of a width x height target.
+func computeReference(ctx context.Context, params MandelbrotParams, width, height int) (*reference, error) {
+	view := newViewport(params, width, height)
+	orbit, err := computeReferenceOrbit(ctx, view, 0, 0, params.MaxIter)
+	if err != nil {
+		return nil, err
+	}
+	ref := &reference{orbit: orbit}
+	if params.SeriesApprox && view.stats == nil { // Orbit statistics need every iteration
+		ref.series = computeSeries(orbit, view, width, height, params.SeriesTerms, params.MaxIter)
+	}
+	return ref, nil
+}
+
+// renderPerturbation fills the pixels of field inside regions using one
+// high-precision reference orbit at the view center, re-referencing glitched
+// pixels until none remain. ref is computed for field when nil.
+func renderPerturbation(ctx context.Context, view viewport, params MandelbrotParams, field *IterField, regions []tile, ref *reference) error {
+	width := field.Width
+	var err error
+	if ref == nil {
+		if ref, err = computeReference(ctx, params, width, field.Height); err != nil {
+			return err
+		}
+	}
+	orbit, series := ref.orbit, ref.series
+
+	var mu sync.Mutex
+	var pending []int
+	for _, region := range regions {
+		err = forEachTile(ctx, region, params.Workers, func(t tile) {
+			var local []int
+			var stats RenderStats
+			defer func() { stats.addTo(&field.Stats) }()
+			for y := t.y0; y < t.y1; y++ {
+				for x := t.x0; x < t.x1; x++ {
+					// Orbit statistics color the interior too, so it has to be iterated
+					if view.stats == nil && view.inBulbs(x, y) {
+						field.Points[y*width+x] = interior(params.MaxIter, 0)
+						stats.count(bulbShortcut)
+						continue
+					}
+					stats.count(noShortcut)
+					p, bad := orbit.perturb(view, series, x, y, params.MaxIter)
+					if bad {
+						local = append(local, y*width+x)
+						continue
+					}
+					field.Points[y*width+x] = p
+				}
+			}
+			mu.Lock()
+			pending = append(pending, local...)
+			mu.Unlock()
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for range maxReferences {
+		if len(pending) == 0 {
+			return nil
+		}
+
+		// Re-reference from the middle of the glitched set
+		slices.Sort(pending)
+		next := pending[len(pending)/2]
+		offRe, offIm := view.offset(next%width, next/width)
+		if orbit, err = computeReferenceOrbit(ctx, view, offRe, offIm, params.MaxIter); err != nil {
+			return err
+		}
+
+		var glitched []int
+		err = forEachChunk(ctx, len(pending), params.Workers, func(lo, hi int) {
+			var local []int
+			for _, idx := range pending[lo:hi] {
+				p, bad := orbit.perturb(view, seriesApproximation{}, idx%width, idx/width, params.MaxIter)
+				if bad {
+					local = append(local, idx)
+					continue
+				}
+				field.Points[idx] = p
+			}
+			mu.Lock()
+			glitched = append(glitched, local...)
+			mu.Unlock()
+		})
+		if err != nil {
+			return err
+		}
+		pending = glitched
+	}
+
+	// Whatever is still glitched gets iterated directly
+	return forEachChunk(ctx, len(pending), params.Workers, func(lo, hi int) {
+		for _, idx := range pending[lo:hi] {
+			field.Points[idx], _ = view.iterate(idx%width, idx/width, params.MaxIter)
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package mandelbrot
+
+import (
+	"math"
+	"math/big"
+)
+
+const (
+	// coordPrecision is the minimum mantissa size (in bits) used for view centers.
+	coordPrecision = 64
+	// highPrecisionThreshold is the pixel size below which float64 can no longer
+	// tell neighbouring pixels apart once the orbit leaves the origin.
+	highPrecisionThreshold = 0x1p-42
+)
+
+// MustParseCoord parses a decimal coordinate at full precision. It panics on
+// malformed input and is meant for literals such as presets.
+func MustParseCoord(s string) *big.Float {
+	f, _, err := big.ParseFloat(s, 10, 256, big.ToNearestEven)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// NewCoord returns a coordinate initialised from a float64.
+func NewCoord(x float64) *big.Float {
+	return new(big.Float).SetPrec(coordPrecision).SetFloat64(x)
+}
+
+// FormatCoord formats a coordinate with enough digits to tell pixels apart at
+// the given zoom factor.
+func FormatCoord(f *big.Float, zoom float64) string {
+	digits := 9
+	if zoom > 0 {
+		digits = max(digits, int(math.Ceil(-math.Log10(zoom)))+6)
+	}
+	return f.Text('f', digits)
+}
+
+// precisionForZoom returns the number of mantissa bits needed to address
+// individual pixels at the given zoom factor.
+func precisionForZoom(zoom float64) uint {
+	if zoom <= 0 || zoom >= 1 {
+		return coordPrecision
+	}
+	return coordPrecision + uint(math.Ceil(-math.Log2(zoom)))
+}
+
+// Precision returns the number of mantissa bits used for the current view.
+func (p MandelbrotParams) Precision() uint {
+	return precisionForZoom(p.ZoomFactor)
+}
+
+// addOffset returns x + d without modifying x, rounded to prec bits.
+func addOffset(x *big.Float, d float64, prec uint) *big.Float {
+	prec = max(prec, x.Prec())
+	r := new(big.Float).SetPrec(prec).SetFloat64(d)
+	return r.Add(r, x)
+}
+
+// withPrecision returns a copy of x with at least prec bits of mantissa.
+func withPrecision(x *big.Float, prec uint) *big.Float {
+	return new(big.Float).SetPrec(max(prec, x.Prec())).Set(x)
+}
+
+// mandelbrotBig is the arbitrary-precision counterpart of mandelbrot, used
+// once the view is too deep for float64.
+func mandelbrotBig(cRe, cIm *big.Float, maxIter int, derivs bool, stats *orbitStats) Point {
+	zero := new(big.Float).SetPrec(cRe.Prec())
+	return escapeTimeBig(zero, zero, cRe, cIm, maxIter, false, derivs, stats)
+}
+
+// escapeTimeBig is the arbitrary-precision counterpart of escapeTime, also
+// collecting stats when they are set. The arguments are not modified. The
+// derivative and stats only need float64.
+func escapeTimeBig(z0Re, z0Im, cRe, cIm *big.Float, maxIter int, julia, derivs bool, stats *orbitStats) Point {
+	prec := cRe.Prec()
+	zRe := new(big.Float).SetPrec(prec).Set(z0Re)
+	zIm := new(big.Float).SetPrec(prec).Set(z0Im)
+	zRe2 := new(big.Float).SetPrec(prec).Mul(zRe, zRe)
+	zIm2 := new(big.Float).SetPrec(prec).Mul(zIm, zIm)
+	tmp := new(big.Float).SetPrec(prec)
+	dz, dc := derivStart(julia)
+	var s orbitStats
+	bailout := 4.0
+	if stats != nil {
+		s = stats.start()
+		bailout = s.bailout()
+	}
+	c := bigComplex(cRe, cIm)
+	for i := range maxIter {
+		if derivs {
+			dz = 2*bigComplex(zRe, zIm)*dz + dc
+		}
+		tmp.Mul(zRe, zIm)
+		zIm.Add(tmp, tmp)
+		zIm.Add(zIm, cIm)
+		zRe.Sub(zRe2, zIm2)
+		zRe.Add(zRe, cRe)
+		zRe2.Mul(zRe, zRe)
+		zIm2.Mul(zIm, zIm)
+		if stats != nil {
+			s.add(bigComplex(zRe, zIm), c)
+		}
+		mag, _ := tmp.Add(zRe2, zIm2).Float64()
+		if mag > bailout {
+			p := escapedDeriv(i, bigComplex(zRe, zIm), dz)
+			p.Value = s.value(p)
+			return p
+		}
+	}
+	p := interior(maxIter, bigComplex(zRe, zIm))
+	p.Value = s.value(p)
+	return p
+}
+
+// bigComplex rounds an arbitrary-precision complex number to complex128.
+func bigComplex(re, im *big.Float) complex128 {
+	r, _ := re.Float64()
+	i, _ := im.Float64()
+	return complex(r, i)
+}
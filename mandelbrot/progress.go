@@ -0,0 +1,27 @@
+package mandelbrot
+
+import "context"
+
+// ProgressFunc receives the number of finished render jobs and the total for
+// the current pass. It is called concurrently from worker goroutines.
+type ProgressFunc func(done, total int)
+
+type progressKey struct{}
+
+// WithProgress returns a context that makes every render started with it
+// report progress to fn.
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// withoutProgress hides the progress callback from cheap follow-up passes
+// such as coloring, so the reported progress never jumps backwards.
+func withoutProgress(ctx context.Context) context.Context {
+	return context.WithValue(ctx, progressKey{}, ProgressFunc(nil))
+}
+
+// progressFrom returns the callback attached to ctx, or nil.
+func progressFrom(ctx context.Context) ProgressFunc {
+	fn, _ := ctx.Value(progressKey{}).(ProgressFunc)
+	return fn
+}
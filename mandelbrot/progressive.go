@@ -0,0 +1,57 @@
+package mandelbrot
+
+import "context"
+
+// ProgressiveScales are the downsampling factors of the passes of a
+// progressive render, from coarse to fine.
+var ProgressiveScales = []int{8, 4, 2, 1}
+
+// RenderProgressive renders a width x height target once per entry of
+// ProgressiveScales, handing each downsampled field to yield; an error
+// returned by yield aborts the render. When the cache attached to ctx holds
+// the same view panned by whole pixels, only the exposed strip is computed
+// and a single full-resolution field is yielded. Buddhabrot renders
+// accumulate samples instead, yielding the full-resolution field after each
+// batch.
+func RenderProgressive(ctx context.Context, params MandelbrotParams, width, height int, yield func(field *IterField) error) error {
+	if isDensity(params.Fractal) {
+		return renderDensity(ctx, params, width, height, true, yield)
+	}
+
+	cache := cacheFrom(ctx)
+	if field, missing, ok := cache.pan(params, width, height); ok {
+		if err := renderRegions(ctx, params, field, missing, nil); err != nil {
+			return err
+		}
+		cache.store(params, field)
+		return yield(field)
+	}
+
+	// The perturbation reference is the same for every pass
+	var ref *reference
+	if usesPerturbation(params) {
+		var err error
+		if ref, err = computeReference(ctx, params, width, height); err != nil {
+			return err
+		}
+	}
+
+	for _, scale := range ProgressiveScales {
+		passWidth := (width + scale - 1) / scale
+		passHeight := (height + scale - 1) / scale
+		if scale > 1 && (passWidth < 2 || passHeight < 2) {
+			continue // too coarse to be worth showing
+		}
+		field := newIterField(passWidth, passHeight, params.MaxIter)
+		if err := renderRegions(ctx, params, field, []tile{frame(passWidth, passHeight)}, ref); err != nil {
+			return err
+		}
+		if scale == 1 {
+			cache.store(params, field)
+		}
+		if err := yield(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package mandelbrot
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// tileSize is the edge length of the square tiles handed to workers.
+	tileSize = 16
+	// chunkSize is the number of pixels per job when working through pixel lists.
+	chunkSize = 256
+)
+
+// tile is a rectangle of pixels [x0, x1) x [y0, y1).
+type tile struct {
+	x0, y0, x1, y1 int
+}
+
+// workerCount resolves a configured worker count, defaulting to GOMAXPROCS.
+func workerCount(workers int) int {
+	if workers <= 0 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return workers
+}
+
+// runJobs feeds job indices [0, n) through a channel to a bounded pool of
+// workers, so a few expensive jobs never hold up the rest. Once ctx is
+// cancelled no further jobs are started and ctx.Err() is returned. Finished
+// jobs are reported to the ProgressFunc attached to ctx.
+func runJobs(ctx context.Context, n, workers int, fn func(job int)) error {
+	progress := progressFrom(ctx)
+	var done atomic.Int64
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(workerCount(workers), n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				fn(job)
+				if progress != nil {
+					progress(int(done.Add(1)), n)
+				}
+			}
+		}()
+	}
+feed:
+	for job := range n {
+		select {
+		case jobs <- job:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return ctx.Err()
+}
+
+// frame returns the region covering a whole width x height target.
+func frame(width, height int) tile {
+	return tile{0, 0, width, height}
+}
+
+// forEachTile splits region into tiles and runs fn on each.
+func forEachTile(ctx context.Context, region tile, workers int, fn func(t tile)) error {
+	return forEachTileSized(ctx, region, tileSize, workers, fn)
+}
+
+// forEachTileSized splits region into tiles of the given size and runs fn on each.
+func forEachTileSized(ctx context.Context, region tile, size, workers int, fn func(t tile)) error {
+	cols := (region.x1 - region.x0 + size - 1) / size
+	rows := (region.y1 - region.y0 + size - 1) / size
+	return runJobs(ctx, cols*rows, workers, func(job int) {
+		x0 := region.x0 + (job%cols)*size
+		y0 := region.y0 + (job/cols)*size
+		fn(tile{x0, y0, min(x0+size, region.x1), min(y0+size, region.y1)})
+	})
+}
+
+// forEachChunk splits [0, n) into chunks and runs fn on each.
+func forEachChunk(ctx context.Context, n, workers int, fn func(lo, hi int)) error {
+	return runJobs(ctx, (n+chunkSize-1)/chunkSize, workers, func(job int) {
+		lo := job * chunkSize
+		fn(lo, min(lo+chunkSize, n))
+	})
+}
@@ -0,0 +1,119 @@
+package mandelbrot
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+const (
+	// seriesTolerance bounds the size of the last series term relative to the first.
+	seriesTolerance = 1e-12
+	// seriesProbeTolerance is the relative error allowed at the probe pixels.
+	seriesProbeTolerance = 1e-6
+	// DefaultSeriesTerms is the number of series terms used by default.
+	DefaultSeriesTerms = 8
+)
+
+// seriesApproximation approximates dz_skip as a polynomial in dc, letting
+// every pixel start iterating at skip instead of 0.
+type seriesApproximation struct {
+	skip   int
+	coeffs []complex128 // coeffs[k] multiplies dc^(k+1)
+}
+
+// at evaluates the series for dc.
+func (s seriesApproximation) at(dc complex128) complex128 {
+	dz := complex(0, 0)
+	for k := len(s.coeffs) - 1; k >= 0; k-- {
+		dz = (dz + s.coeffs[k]) * dc
+	}
+	return dz
+}
+
+// derivAt evaluates the derivative of the series by dc, which is dz/dc at
+// the skipped iteration.
+func (s seriesApproximation) derivAt(dc complex128) complex128 {
+	d := complex(0, 0)
+	for k := len(s.coeffs) - 1; k >= 0; k-- {
+		d = d*dc + complex(float64(k+1), 0)*s.coeffs[k]
+	}
+	return d
+}
+
+// stepSeries advances the coefficients by one iteration of the reference orbit:
+// a1' = 2Z a1 + 1, ak' = 2Z ak + sum(ai * a(k-i)).
+func stepSeries(coeffs []complex128, z complex128) []complex128 {
+	next := make([]complex128, len(coeffs))
+	for k := range coeffs {
+		next[k] = 2 * z * coeffs[k]
+		for i := range k {
+			next[k] += coeffs[i] * coeffs[k-1-i]
+		}
+	}
+	next[0]++
+	return next
+}
+
+// computeSeries finds how many iterations the series can skip for every
+// pixel of the view, then verifies the result against probe pixels.
+func computeSeries(orbit referenceOrbit, view viewport, width, height, terms, maxIter int) seriesApproximation {
+	if terms < 1 {
+		return seriesApproximation{}
+	}
+
+	// Probe the corners and edge midpoints; they bound |dc| for the whole view
+	var probes []complex128
+	radius := 0.0
+	for _, y := range []int{0, height / 2, height - 1} {
+		for _, x := range []int{0, width / 2, width - 1} {
+			dRe, dIm := view.offset(x, y)
+			dc := complex(dRe-orbit.offRe, dIm-orbit.offIm)
+			probes = append(probes, dc)
+			radius = math.Max(radius, cmplx.Abs(dc))
+		}
+	}
+
+	coeffs := make([]complex128, terms)
+	series := seriesApproximation{coeffs: coeffs}
+	for n := 0; n+1 < len(orbit.z) && n < maxIter; n++ {
+		next := stepSeries(coeffs, orbit.z[n])
+		first := cmplx.Abs(next[0]) * radius
+		last := cmplx.Abs(next[terms-1]) * math.Pow(radius, float64(terms))
+		if math.IsInf(last, 0) || math.IsNaN(last) || last > seriesTolerance*first {
+			break
+		}
+		coeffs = next
+		series = seriesApproximation{skip: n + 1, coeffs: coeffs}
+	}
+
+	for series.skip > 0 && !series.matches(orbit, probes) {
+		series = seriesAt(orbit, terms, series.skip/2)
+	}
+	return series
+}
+
+// seriesAt recomputes the coefficients for a given skip.
+func seriesAt(orbit referenceOrbit, terms, skip int) seriesApproximation {
+	coeffs := make([]complex128, terms)
+	for n := range skip {
+		coeffs = stepSeries(coeffs, orbit.z[n])
+	}
+	return seriesApproximation{skip: skip, coeffs: coeffs}
+}
+
+// matches compares the series against plain perturbation at the probes.
+func (s seriesApproximation) matches(orbit referenceOrbit, probes []complex128) bool {
+	for _, dc := range probes {
+		dz := complex(0, 0)
+		for n := range s.skip {
+			dz = 2*orbit.z[n]*dz + dz*dz + dc
+			if z := orbit.z[n+1] + dz; real(z)*real(z)+imag(z)*imag(z) > 4 {
+				return false
+			}
+		}
+		if cmplx.Abs(s.at(dc)-dz) > seriesProbeTolerance*cmplx.Abs(dz) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,130 @@
+package mandelbrot
+
+import (
+	"context"
+	"math"
+)
+
+const (
+	// subdivideTileSize is the tile size used with subdivision; larger tiles
+	// leave more room for uniform rectangles.
+	subdivideTileSize = 64
+	// minSubdivide is the edge length below which rectangles are iterated
+	// pixel by pixel instead of being split further.
+	minSubdivide = 4
+)
+
+// subdivider fills a tile using the Mariani-Silver algorithm: it computes
+// the border of a rectangle, fills the rectangle when the border is uniform
+// and splits it into quadrants otherwise.
+type subdivider struct {
+	ctx     context.Context
+	t       tile
+	field   *IterField
+	view    viewport
+	maxIter int
+	flat    bool   // Escaped areas may be filled too, see flatFill
+	done    []bool // Pixels of the tile computed so far
+	stats   RenderStats
+}
+
+func newSubdivider(ctx context.Context, t tile, field *IterField, view viewport, maxIter int, flat bool) *subdivider {
+	return &subdivider{
+		ctx:     ctx,
+		t:       t,
+		field:   field,
+		view:    view,
+		maxIter: maxIter,
+		flat:    flat,
+		done:    make([]bool, (t.x1-t.x0)*(t.y1-t.y0)),
+	}
+}
+
+// subdivides reports whether params render with subdivision. A uniform
+// border only proves a uniform inside for connected sets: the Mandelbrot and
+// Julia sets of z^2, integer powers and the Tricorn. Burning Ship, Celtic,
+// Buffalo and custom formulas, fractional powers, Newton basins and Lyapunov
+// regions can have holes.
+func subdivides(params MandelbrotParams) bool {
+	if !params.Subdivide || params.Fractal != FractalMandelbrot && params.Fractal != FractalJulia {
+		return false
+	}
+	switch params.Formula {
+	case FormulaQuadratic, FormulaTricorn:
+		return true
+	case FormulaMultibrot:
+		return params.Exponent == math.Trunc(params.Exponent)
+	}
+	return false
+}
+
+// flatFill reports whether the colors of escaped points depend on nothing
+// but their iteration count, so copies of one point can fill a uniform area.
+// Other colorings need the final z of every pixel, and only interior areas,
+// which they all leave black, are filled.
+func (c ColorParams) flatFill() bool {
+	return !c.Smooth && !c.Lighting && (c.Coloring == ColoringIteration || c.Coloring == ColoringHistogram)
+}
+
+// at computes pixel (x, y) once and returns its point.
+func (s *subdivider) at(x, y int) Point {
+	i := (y-s.t.y0)*(s.t.x1-s.t.x0) + (x - s.t.x0)
+	if !s.done[i] {
+		p, how := s.view.iterate(x, y, s.maxIter)
+		s.field.Points[y*s.field.Width+x] = p
+		s.stats.count(how)
+		s.done[i] = true
+	}
+	return s.field.Points[y*s.field.Width+x]
+}
+
+// fill computes the rectangle r, which must lie within the tile.
+func (s *subdivider) fill(r tile) {
+	if s.ctx.Err() != nil {
+		return
+	}
+	if r.x1-r.x0 <= minSubdivide || r.y1-r.y0 <= minSubdivide {
+		for y := r.y0; y < r.y1; y++ {
+			for x := r.x0; x < r.x1; x++ {
+				s.at(x, y)
+			}
+		}
+		return
+	}
+
+	first := s.at(r.x0, r.y0)
+	uniform := true
+	same := func(x, y int) {
+		p := s.at(x, y)
+		uniform = uniform && p.Iter == first.Iter && p.Escaped == first.Escaped && p.Root == first.Root && p.Value == first.Value
+	}
+	for x := r.x0; x < r.x1; x++ {
+		same(x, r.y0)
+		same(x, r.y1-1)
+	}
+	for y := r.y0; y < r.y1; y++ {
+		same(r.x0, y)
+		same(r.x1-1, y)
+	}
+
+	if uniform && (s.flat || !first.Escaped) {
+		for y := r.y0 + 1; y < r.y1-1; y++ {
+			for x := r.x0 + 1; x < r.x1-1; x++ {
+				i := (y-s.t.y0)*(s.t.x1-s.t.x0) + (x - s.t.x0)
+				if !s.done[i] {
+					s.field.Points[y*s.field.Width+x] = first
+					s.done[i] = true
+					s.stats.Pixels++
+					s.stats.Filled++
+				}
+			}
+		}
+		return
+	}
+
+	mx, my := (r.x0+r.x1)/2, (r.y0+r.y1)/2
+	s.fill(tile{r.x0, r.y0, mx, my})
+	s.fill(tile{mx, r.y0, r.x1, my})
+	s.fill(tile{r.x0, my, mx, r.y1})
+	s.fill(tile{mx, my, r.x1, r.y1})
+}
@@ -0,0 +1,112 @@
+package mandelbrot
+
+import (
+	"context"
+	"testing"
+)
+
+// TestSubdivideMatchesBruteForce renders views with subdivision on and off
+// and checks that the points and colors come out the same.
+func TestSubdivideMatchesBruteForce(t *testing.T) {
+	const width, height = 128, 72
+
+	mandelbrotView := InitialMandelbrotParams()
+
+	julia := InitialMandelbrotParams()
+	julia.SetFractal(FractalJulia)
+	julia.JuliaRe, julia.JuliaIm = -0.123, 0.745
+
+	formula := func(kind int, exponent float64) MandelbrotParams {
+		p := InitialMandelbrotParams()
+		p.SetFormula(kind)
+		p.Exponent = exponent
+		return p
+	}
+
+	newton := InitialMandelbrotParams()
+	newton.SetFractal(FractalNewton)
+
+	deep := InitialMandelbrotParams()
+	deep.CenterRe = MustParseCoord("-1.76877877000001")
+	deep.CenterIm = MustParseCoord("-0.00173894200001")
+	deep.ZoomFactor = 1e-12
+	deep.MaxIter = 1000
+	deep.Engine = EnginePerturbation
+
+	views := []struct {
+		name   string
+		params MandelbrotParams
+		fills  bool // Whether subdivision applies to the view
+	}{
+		{"mandelbrot", mandelbrotView, true},
+		{"julia", julia, true},
+		{"multibrot", formula(FormulaMultibrot, 3), true},
+		{"fractional multibrot", formula(FormulaMultibrot, 2.5), false},
+		{"tricorn", formula(FormulaTricorn, 2), true},
+		{"burning ship", formula(FormulaBurningShip, 2), false},
+		{"celtic", formula(FormulaCeltic, 2), false},
+		{"buffalo", formula(FormulaBuffalo, 2), false},
+		{"custom", formula(FormulaCustom, 2), false},
+		{"newton", newton, false},
+		{"deep perturbation", deep, false},
+	}
+	colorings := []struct {
+		name   string
+		colors func(*ColorParams)
+	}{
+		{"smooth", func(c *ColorParams) { c.Smooth = true }},
+		{"flat", func(c *ColorParams) { c.Smooth = false }},
+		{"histogram", func(c *ColorParams) { c.Smooth, c.Coloring = false, ColoringHistogram }},
+		{"distance", func(c *ColorParams) { c.Coloring = ColoringDistance }},
+		{"lighting", func(c *ColorParams) { c.Lighting = true }},
+	}
+
+	for _, view := range views {
+		for _, coloring := range colorings {
+			t.Run(view.name+"/"+coloring.name, func(t *testing.T) {
+				params := view.params
+				params.Width, params.Height = width, height
+				coloring.colors(&params.ColorParams)
+
+				params.Subdivide = false
+				want, err := RenderField(context.Background(), params, width, height)
+				if err != nil {
+					t.Fatal(err)
+				}
+				params.Subdivide = true
+				got, err := RenderField(context.Background(), params, width, height)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if filled := got.Stats.Filled > 0; filled != view.fills {
+					t.Errorf("filled %d pixels, want filling %v", got.Stats.Filled, view.fills)
+				}
+				for i, p := range got.Points {
+					w := want.Points[i]
+					if p.Iter != w.Iter || p.Escaped != w.Escaped || p.Root != w.Root || p.Value != w.Value {
+						t.Fatalf("pixel (%d, %d) = %+v, want %+v", i%width, i/width, p, w)
+					}
+					if p.Escaped && !got.Flat && p != w {
+						t.Fatalf("escaped pixel (%d, %d) = %+v, want %+v", i%width, i/width, p, w)
+					}
+				}
+
+				wantImg, err := ColorizeImage(context.Background(), params, want)
+				if err != nil {
+					t.Fatal(err)
+				}
+				gotImg, err := ColorizeImage(context.Background(), params, got)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for i := range gotImg.Pix {
+					if gotImg.Pix[i] != wantImg.Pix[i] {
+						p := i / 4
+						t.Fatalf("color of pixel (%d, %d) differs", p%width, p/width)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package mandelbrot
+
+import (
+	"image/color"
+	"math"
+)
+
+// Orbit trap shapes
+const (
+	TrapPoint  = iota
+	TrapLine   // horizontal line through the center
+	TrapCross  // horizontal and vertical lines, for Pickover stalks
+	TrapCircle // circle of radius Size around the center
+	TrapCount
+)
+
+var TrapNames = map[int]string{
+	TrapPoint:  "Point",
+	TrapLine:   "Line",
+	TrapCross:  "Cross",
+	TrapCircle: "Circle",
+}
+
+// DefaultTrap gives Pickover stalks.
+var DefaultTrap = OrbitTrap{Shape: TrapCross, Size: 0.1}
+
+// OrbitTrap is the shape orbits are measured against by orbit trap coloring.
+type OrbitTrap struct {
+	Shape  int
+	Center complex128
+	Size   float64 // Radius of circles, the reach of the other shapes
+}
+
+// distance returns how far z is from the trap, relative to its size.
+func (t OrbitTrap) distance(z complex128) float64 {
+	d := z - t.Center
+	switch t.Shape {
+	case TrapLine:
+		return math.Abs(imag(d)) / t.Size
+	case TrapCross:
+		return math.Min(math.Abs(real(d)), math.Abs(imag(d))) / t.Size
+	case TrapCircle:
+		return math.Abs(math.Hypot(real(d), imag(d))-t.Size) / t.Size
+	default:
+		return math.Hypot(real(d), imag(d)) / t.Size
+	}
+}
+
+// trapColor colors a point by how close its orbit came to the trap, inside
+// the set as well as outside.
+func trapColor(colors ColorParams, p Point) color.Color {
+	t := math.Min(1, math.Sqrt(p.Value))
+	return colors.scheme(t)
+}
@@ -0,0 +1,129 @@
+package mandelbrot
+
+import (
+	"math"
+	"math/big"
+	"math/cmplx"
+)
+
+// viewWidth is the width of the view in the complex plane at zoom 1.
+const viewWidth = 3.25
+
+// viewport maps the pixels of a render target onto the complex plane.
+type viewport struct {
+	centerRe, centerIm *big.Float
+	re, im             float64 // float64 approximation of the center
+	minRe, minIm       float64 // offset of the top-left pixel from the center
+	deltaRe, deltaIm   float64 // size of a single pixel
+	prec               uint
+	highPrecision      bool
+	fractal            int
+	seed               complex128   // Julia seed
+	formula            Formula      // nil for the quadratic fast path
+	roots              []complex128 // Newton polynomial roots
+	sequence           []bool       // Lyapunov sequence, true for B
+	stats              *orbitStats  // Orbit statistic of the coloring, if any
+	derivs             bool         // Track the derivative of z for the coloring
+}
+
+// newViewport creates a viewport for a width x height target. The aspect
+// ratio always follows params.Width/params.Height so text and images match.
+func newViewport(params MandelbrotParams, width, height int) viewport {
+	aspectRatio := float64(params.Height) / float64(params.Width)
+	scale := viewWidth * params.ZoomFactor
+	re, _ := params.CenterRe.Float64()
+	im, _ := params.CenterIm.Float64()
+
+	v := viewport{
+		centerRe: params.CenterRe,
+		centerIm: params.CenterIm,
+		re:       re,
+		im:       im,
+		minRe:    -scale / 2,
+		minIm:    -scale * aspectRatio / 2,
+		deltaRe:  scale / float64(width),
+		deltaIm:  scale * aspectRatio / float64(height),
+		prec:     params.Precision(),
+		fractal:  params.Fractal,
+		seed:     complex(params.JuliaRe, params.JuliaIm),
+		derivs:   params.ColorParams.needsDeriv(),
+	}
+	if params.Formula != FormulaQuadratic {
+		v.formula = NewFormula(params.Formula, params.Exponent)
+	}
+	v.stats = newOrbitStats(params)
+	v.highPrecision = math.Min(v.deltaRe, v.deltaIm) < highPrecisionThreshold
+	return v
+}
+
+// offset returns the distance of pixel (x, y) from the view center.
+func (v viewport) offset(x, y int) (float64, float64) {
+	return v.minRe + float64(x)*v.deltaRe, v.minIm + float64(y)*v.deltaIm
+}
+
+// iterate runs the escape-time kernel for pixel (x, y), switching to
+// arbitrary precision when float64 runs out of bits. Only the quadratic
+// formula has an arbitrary-precision kernel.
+func (v viewport) iterate(x, y int, maxIter int) (Point, shortcut) {
+	dRe, dIm := v.offset(x, y)
+	switch v.fractal {
+	case FractalNewton:
+		return newton(complex(v.re+dRe, v.im+dIm), v.roots, maxIter), noShortcut
+	case FractalLyapunov:
+		return lyapunov(v.re+dRe, v.im+dIm, v.sequence, maxIter), noShortcut
+	}
+	if v.formula != nil || v.stats != nil && !v.highPrecision {
+		f := v.formula
+		if f == nil {
+			f = Quadratic{}
+		}
+		p := complex(v.re+dRe, v.im+dIm)
+		if v.fractal == FractalJulia {
+			return escapeTimeFormula(f, p, v.seed, maxIter, true, v.derivs, v.stats)
+		}
+		return escapeTimeFormula(f, 0, p, maxIter, false, v.derivs, v.stats)
+	}
+	if !v.highPrecision {
+		p := complex(v.re+dRe, v.im+dIm)
+		if v.fractal == FractalJulia {
+			return escapeTime(p, v.seed, maxIter, true, v.derivs)
+		}
+		return mandelbrot(p, maxIter, v.derivs)
+	}
+
+	pRe := addOffset(v.centerRe, dRe, v.prec).SetPrec(v.prec)
+	pIm := addOffset(v.centerIm, dIm, v.prec).SetPrec(v.prec)
+	if v.fractal == FractalJulia {
+		seedRe := new(big.Float).SetPrec(v.prec).SetFloat64(real(v.seed))
+		seedIm := new(big.Float).SetPrec(v.prec).SetFloat64(imag(v.seed))
+		return escapeTimeBig(pRe, pIm, seedRe, seedIm, maxIter, true, v.derivs, v.stats), noShortcut
+	}
+	return mandelbrotBig(pRe, pIm, maxIter, v.derivs, v.stats), noShortcut
+}
+
+// inBulbs reports whether pixel (x, y) is in the main cardioid or period-2
+// bulb. Its float64 coordinate, the reference at the view center plus the
+// pixel's delta, is off by rounding, which only matters once pixels are
+// smaller than that: deeper views test with a margin.
+func (v viewport) inBulbs(x, y int) bool {
+	dRe, dIm := v.offset(x, y)
+	c := complex(v.re, v.im) + complex(dRe, dIm)
+	if !v.highPrecision {
+		return inMainBulbs(c)
+	}
+	return inMainBulbsMargin(c, bulbMargin*math.Max(1, cmplx.Abs(c)))
+}
+
+// hasBigKernel reports whether the fractal can be iterated in arbitrary
+// precision; only the quadratic Mandelbrot and Julia sets can.
+func (v viewport) hasBigKernel() bool {
+	return v.formula == nil && (v.fractal == FractalMandelbrot || v.fractal == FractalJulia)
+}
+
+// PixelCoord returns the point of the complex plane under pixel (x, y) of a
+// width x height target.
+func (p MandelbrotParams) PixelCoord(x, y, width, height int) (*big.Float, *big.Float) {
+	v := newViewport(p, width, height)
+	dRe, dIm := v.offset(x, y)
+	return addOffset(v.centerRe, dRe, v.prec), addOffset(v.centerIm, dIm, v.prec)
+}
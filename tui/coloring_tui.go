@@ -0,0 +1,100 @@
+package tui
+
+import (
+	"fmt"
+	"mandel-cli/mandelbrot"
+	"strconv"
+
+	"github.com/charmbracelet/huh"
+)
+
+// coloringForm edits the settings of the current orbit coloring: the stripe
+// density for stripe averages, the orbit trap otherwise.
+func coloringForm(params mandelbrot.MandelbrotParams) settingsForm {
+	if params.Coloring == mandelbrot.ColoringStripe {
+		return stripeForm(params)
+	}
+	return trapForm(params)
+}
+
+func stripeForm(params mandelbrot.MandelbrotParams) settingsForm {
+	density := strconv.FormatFloat(params.StripeDensity, 'g', -1, 64)
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				Title("Stripe density").
+				Description("Number of stripes per turn around the origin").
+				Key("density").
+				Value(&density).
+				Validate(func(s string) error {
+					if n, err := strconv.ParseFloat(s, 64); err != nil || n <= 0 {
+						return fmt.Errorf("density must be a positive number")
+					}
+					return nil
+				}),
+		),
+	)
+	return settingsForm{form: form, apply: func(p *mandelbrot.MandelbrotParams, form *huh.Form) error {
+		p.StripeDensity, _ = strconv.ParseFloat(form.GetString("density"), 64)
+		return nil
+	}}
+}
+
+// trapForm edits the orbit trap, switching to orbit trap coloring when it is
+// applied.
+func trapForm(params mandelbrot.MandelbrotParams) settingsForm {
+	trap := params.Trap
+	shape := trap.Shape
+	var shapes []huh.Option[int]
+	for i := range mandelbrot.TrapCount {
+		shapes = append(shapes, huh.NewOption(mandelbrot.TrapNames[i], i))
+	}
+	number := func(s string) error {
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return fmt.Errorf("not a number")
+		}
+		return nil
+	}
+	re := strconv.FormatFloat(real(trap.Center), 'g', -1, 64)
+	im := strconv.FormatFloat(imag(trap.Center), 'g', -1, 64)
+	size := strconv.FormatFloat(trap.Size, 'g', -1, 64)
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[int]().
+				Title("Trap shape").
+				Key("shape").
+				Options(shapes...).
+				Value(&shape),
+			huh.NewInput().
+				Title("Center (real)").
+				Key("re").
+				Value(&re).
+				Validate(number),
+			huh.NewInput().
+				Title("Center (imaginary)").
+				Key("im").
+				Value(&im).
+				Validate(number),
+			huh.NewInput().
+				Title("Size").
+				Description("Radius of the circle, how far the color reaches for the other shapes").
+				Key("size").
+				Value(&size).
+				Validate(func(s string) error {
+					if n, err := strconv.ParseFloat(s, 64); err != nil || n <= 0 {
+						return fmt.Errorf("size must be a positive number")
+					}
+					return nil
+				}),
+		),
+	)
+	return settingsForm{form: form, apply: func(p *mandelbrot.MandelbrotParams, form *huh.Form) error {
+		re, _ := strconv.ParseFloat(form.GetString("re"), 64)
+		im, _ := strconv.ParseFloat(form.GetString("im"), 64)
+		size, _ := strconv.ParseFloat(form.GetString("size"), 64)
+		shape, _ := form.Get("shape").(int)
+		p.Trap = mandelbrot.OrbitTrap{Shape: shape, Center: complex(re, im), Size: size}
+		p.Coloring = mandelbrot.ColoringOrbitTrap
+		return nil
+	}}
+}
@@ -0,0 +1,395 @@
+package tui
+
+import (
+	"fmt"
+	"mandel-cli/mandelbrot"
+	"mandel-cli/utils"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/huh"
+)
+
+// formulaDescriptions describes each built-in formula in the selection list
+var formulaDescriptions = map[int]string{
+	mandelbrot.FormulaQuadratic:   "z = z² + c",
+	mandelbrot.FormulaMultibrot:   "z = zⁿ + c, n adjusted with n/N",
+	mandelbrot.FormulaBurningShip: "z = (|Re z| + i|Im z|)² + c",
+	mandelbrot.FormulaTricorn:     "z = conj(z)² + c",
+	mandelbrot.FormulaCeltic:      "z = |Re z²| + i Im z² + c",
+	mandelbrot.FormulaBuffalo:     "z = |Re z²| + i|Im z²| + c",
+	mandelbrot.FormulaCustom:      "Enter your own formula and bailout",
+}
+
+// fractalDescriptions describes the fractal types that are not Mandelbrot
+// formulas
+var fractalDescriptions = map[int]string{
+	mandelbrot.FractalNewton:     "Newton's method, colored by root",
+	mandelbrot.FractalBuddhabrot: "Density of escaping orbits",
+	mandelbrot.FractalNebulabrot: "Buddhabrot with three iteration limits as RGB",
+	mandelbrot.FractalLyapunov:   "Stability of the logistic map over an A/B sequence",
+	mandelbrot.FractalMandelbulb: "Ray marched 3D Mandelbulb, rotated with alt+arrows",
+}
+
+// fractalChoice is an entry of the selection list
+type fractalChoice struct {
+	item
+	fractal, formula int
+}
+
+// fractalChoices lists the Mandelbrot formulas followed by the other fractal types
+func fractalChoices() []fractalChoice {
+	var choices []fractalChoice
+	for formula := range mandelbrot.FormulaCount {
+		choices = append(choices, fractalChoice{
+			item:    item{title: mandelbrot.FormulaNames[formula], desc: formulaDescriptions[formula]},
+			fractal: mandelbrot.FractalMandelbrot,
+			formula: formula,
+		})
+	}
+	for fractal := range mandelbrot.FractalCount {
+		if desc, ok := fractalDescriptions[fractal]; ok {
+			choices = append(choices, fractalChoice{
+				item:    item{title: mandelbrot.FractalNames[fractal], desc: desc},
+				fractal: fractal,
+			})
+		}
+	}
+	return choices
+}
+
+type FormulaModel struct {
+	list     list.Model
+	settings settingsForm // Settings input, shown instead of the list when set
+}
+
+func initFormulaModel() FormulaModel {
+	var items []list.Item
+	for _, choice := range fractalChoices() {
+		items = append(items, choice)
+	}
+
+	delegate := list.NewDefaultDelegate()
+	formulaList := list.New(items, delegate, 0, 0)
+	formulaList.DisableQuitKeybindings()
+	formulaList.SetFilteringEnabled(false)
+	formulaList.AdditionalShortHelpKeys = func() []key.Binding {
+		return []key.Binding{presetKeys.Select}
+	}
+	formulaList.AdditionalFullHelpKeys = func() []key.Binding {
+		return []key.Binding{presetKeys.Select}
+	}
+	formulaList.Title = "Select Fractal:"
+	return FormulaModel{list: formulaList}
+}
+
+// selectFractal moves the list selection to the current fractal.
+func (m *Model) selectFractal() {
+	for i, choice := range fractalChoices() {
+		if choice.fractal == m.params.Fractal && (choice.fractal != mandelbrot.FractalMandelbrot || choice.formula == m.params.Formula) {
+			m.formulaModel.list.Select(i)
+			return
+		}
+	}
+}
+
+// settingsForm is the input form for the settings of a fractal.
+type settingsForm struct {
+	form *huh.Form
+	// apply validates the input and stores it in params
+	apply func(params *mandelbrot.MandelbrotParams, form *huh.Form) error
+}
+
+// initSettingsForm creates the settings form of the current fractal, or the
+// custom formula input when custom is set, starting from the current values.
+func initSettingsForm(params mandelbrot.MandelbrotParams, custom bool) settingsForm {
+	var s settingsForm
+	switch {
+	case custom:
+		s = customFormulaForm(params)
+	case params.Fractal == mandelbrot.FractalNewton:
+		s = newtonForm(params)
+	case params.Fractal == mandelbrot.FractalBuddhabrot || params.Fractal == mandelbrot.FractalNebulabrot:
+		s = buddhabrotForm(params)
+	case params.Fractal == mandelbrot.FractalLyapunov:
+		s = lyapunovForm(params)
+	case params.Fractal == mandelbrot.FractalMandelbulb:
+		s = mandelbulbForm(params)
+	default:
+		s = customFormulaForm(params)
+	}
+	return s
+}
+
+func customFormulaForm(params mandelbrot.MandelbrotParams) settingsForm {
+	expression := utils.Ternary(params.Expression == "", mandelbrot.DefaultExpression, params.Expression)
+	bailout := utils.Ternary(params.Bailout == "", mandelbrot.DefaultBailout, params.Bailout)
+	// The form stays open with the input until both compile together
+	compiles := func(string) error {
+		_, err := mandelbrot.CompileFormula(expression, bailout)
+		return err
+	}
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				Title("Formula").
+				Description("Operators + - * / ^, functions pow sin cos exp log abs conj..., variables z and c, constants i pi e").
+				Key("expression").
+				Value(&expression).
+				Validate(compiles),
+			huh.NewInput().
+				Title("Bailout").
+				Description("Condition that ends the orbit, comparing real parts").
+				Key("bailout").
+				Value(&bailout).
+				Validate(compiles),
+		),
+	)
+	return settingsForm{form: form, apply: func(p *mandelbrot.MandelbrotParams, form *huh.Form) error {
+		expression, bailout := form.GetString("expression"), form.GetString("bailout")
+		if _, err := mandelbrot.CompileFormula(expression, bailout); err != nil {
+			return err
+		}
+		p.Expression, p.Bailout = expression, bailout
+		if p.Fractal != mandelbrot.FractalMandelbrot || p.Formula != mandelbrot.FormulaCustom {
+			p.SetFormula(mandelbrot.FormulaCustom)
+		}
+		return nil
+	}}
+}
+
+func newtonForm(params mandelbrot.MandelbrotParams) settingsForm {
+	roots := utils.Ternary(params.Roots == "", mandelbrot.DefaultRoots, params.Roots)
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				Title("Roots").
+				Description("Comma separated roots of the polynomial, e.g. 1, -0.5+0.866i, -0.5-0.866i").
+				Key("roots").
+				Value(&roots).
+				Validate(func(s string) error {
+					_, err := mandelbrot.ParseRoots(s)
+					return err
+				}),
+		),
+	)
+	return settingsForm{form: form, apply: func(p *mandelbrot.MandelbrotParams, form *huh.Form) error {
+		roots := form.GetString("roots")
+		if _, err := mandelbrot.ParseRoots(roots); err != nil {
+			return fmt.Errorf("roots: %w", err)
+		}
+		p.Roots = roots
+		return nil
+	}}
+}
+
+func buddhabrotForm(params mandelbrot.MandelbrotParams) settingsForm {
+	samples := strconv.Itoa(params.Samples)
+	seed := strconv.FormatInt(params.Seed, 10)
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				Title("Samples per pixel").
+				Key("samples").
+				Value(&samples).
+				Validate(func(s string) error {
+					if n, err := strconv.Atoi(s); err != nil || n < 1 {
+						return fmt.Errorf("samples must be a positive number")
+					}
+					return nil
+				}),
+			huh.NewInput().
+				Title("Seed").
+				Description("Renders with the same seed are identical").
+				Key("seed").
+				Value(&seed).
+				Validate(func(s string) error {
+					if _, err := strconv.ParseInt(s, 10, 64); err != nil {
+						return fmt.Errorf("seed must be a whole number")
+					}
+					return nil
+				}),
+		),
+	)
+	return settingsForm{form: form, apply: func(p *mandelbrot.MandelbrotParams, form *huh.Form) error {
+		p.Samples, _ = strconv.Atoi(form.GetString("samples"))
+		p.Seed, _ = strconv.ParseInt(form.GetString("seed"), 10, 64)
+		return nil
+	}}
+}
+
+func lyapunovForm(params mandelbrot.MandelbrotParams) settingsForm {
+	sequence := utils.Ternary(params.Sequence == "", mandelbrot.DefaultSequence, params.Sequence)
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				Title("Sequence").
+				Description("Order in which r takes the values a (real axis) and b (imaginary axis), e.g. AABAB").
+				Key("sequence").
+				Value(&sequence).
+				Validate(func(s string) error {
+					_, err := mandelbrot.ParseSequence(s)
+					return err
+				}),
+		),
+	)
+	return settingsForm{form: form, apply: func(p *mandelbrot.MandelbrotParams, form *huh.Form) error {
+		sequence := form.GetString("sequence")
+		if _, err := mandelbrot.ParseSequence(sequence); err != nil {
+			return fmt.Errorf("sequence: %w", err)
+		}
+		p.Sequence = sequence
+		return nil
+	}}
+}
+
+func mandelbulbForm(params mandelbrot.MandelbrotParams) settingsForm {
+	cam := params.Camera
+	fields := []struct{ key, title, value string }{
+		{"power", "Power", strconv.FormatFloat(params.Power, 'g', -1, 64)},
+		{"x", "Target X", strconv.FormatFloat(cam.TargetX, 'g', -1, 64)},
+		{"y", "Target Y", strconv.FormatFloat(cam.TargetY, 'g', -1, 64)},
+		{"z", "Target Z", strconv.FormatFloat(cam.TargetZ, 'g', -1, 64)},
+		{"yaw", "Yaw (degrees)", strconv.FormatFloat(cam.Yaw*180/math.Pi, 'g', 6, 64)},
+		{"pitch", "Pitch (degrees)", strconv.FormatFloat(cam.Pitch*180/math.Pi, 'g', 6, 64)},
+		{"distance", "Distance", strconv.FormatFloat(cam.Distance, 'g', -1, 64)},
+	}
+	var inputs []huh.Field
+	for _, f := range fields {
+		value := f.value
+		inputs = append(inputs, huh.NewInput().
+			Title(f.title).
+			Key(f.key).
+			Value(&value).
+			Validate(func(s string) error {
+				if _, err := strconv.ParseFloat(s, 64); err != nil {
+					return fmt.Errorf("%s must be a number", strings.ToLower(f.title))
+				}
+				return nil
+			}))
+	}
+	form := huh.NewForm(huh.NewGroup(inputs...))
+	return settingsForm{form: form, apply: func(p *mandelbrot.MandelbrotParams, form *huh.Form) error {
+		get := func(key string) float64 {
+			v, _ := strconv.ParseFloat(form.GetString(key), 64)
+			return v
+		}
+		if get("power") < 1.25 {
+			return fmt.Errorf("power must be at least 1.25")
+		}
+		if get("distance") <= 0 {
+			return fmt.Errorf("distance must be positive")
+		}
+		p.Power = get("power")
+		p.Camera = mandelbrot.Camera{
+			TargetX:  get("x"),
+			TargetY:  get("y"),
+			TargetZ:  get("z"),
+			Distance: get("distance"),
+		}
+		p.Camera.Rotate(get("yaw")*math.Pi/180, get("pitch")*math.Pi/180)
+		return nil
+	}}
+}
+
+// openSettings shows the settings form of the current fractal, or the custom
+// formula input when custom is set.
+func (m *Model) openSettings(custom bool) {
+	m.showSettings(initSettingsForm(m.params, custom))
+}
+
+// showSettings shows a settings form in place of the fractal list.
+func (m *Model) showSettings(s settingsForm) {
+	m.view = FormulaView
+	s.form = s.form.WithTheme(huh.ThemeCharm())
+	s.form.Init()
+	h, v := docStyle.GetFrameSize()
+	s.form.WithWidth(m.width - h).WithHeight(m.height - v)
+	m.formulaModel.settings = s
+}
+
+// updateSettings handles the settings form, applying it once it is
+// submitted. Invalid input is reported in the menu panel.
+func (m Model) updateSettings(msg tea.Msg) (tea.Model, tea.Cmd) {
+	settings := &m.formulaModel.settings
+	if msg, ok := msg.(tea.KeyMsg); ok && msg.String() == "esc" {
+		settings.form = nil
+		m.view = MandelbrotView
+		return m, nil
+	}
+
+	model, cmd := settings.form.Update(msg)
+	if form, ok := model.(*huh.Form); ok {
+		settings.form = form
+	}
+	if settings.form.State != huh.StateCompleted {
+		return m, cmd
+	}
+
+	form := settings.form
+	settings.form = nil
+	m.view = MandelbrotView
+	fractal, formula := m.params.Fractal, m.params.Formula
+	if err := settings.apply(&m.params, form); err != nil {
+		m.mandelbortModel.errorMsg = err.Error()
+		return m, nil
+	}
+	m.mandelbortModel.errorMsg = ""
+	if m.params.Fractal != fractal || m.params.Formula != formula {
+		m.mandelbortModel.parentView = nil
+	}
+	m.mandelbortModel.paramsChanged = true
+	redraw := m.RedrawMandelbrot()
+	return m, redraw
+}
+
+func (m Model) UpdateFormula(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if m.formulaModel.settings.form != nil {
+		return m.updateSettings(msg)
+	}
+
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		h, v := docStyle.GetFrameSize()
+		m.formulaModel.list.SetSize(msg.Width-h, msg.Height-v)
+
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "enter":
+			choice, ok := m.formulaModel.list.SelectedItem().(fractalChoice)
+			if !ok {
+				break
+			}
+			if choice.fractal == mandelbrot.FractalMandelbrot && choice.formula == mandelbrot.FormulaCustom {
+				m.openSettings(true)
+				return m, nil
+			}
+			if choice.fractal == mandelbrot.FractalMandelbrot {
+				m.params.SetFormula(choice.formula)
+			} else {
+				m.params.SetFractal(choice.fractal)
+			}
+			m.mandelbortModel.parentView = nil
+			m.view = MandelbrotView
+			m.mandelbortModel.paramsChanged = true
+		case "esc", "q":
+			m.view = MandelbrotView
+		}
+	}
+
+	var cmd tea.Cmd
+	m.formulaModel.list, cmd = m.formulaModel.list.Update(msg)
+	redraw := m.RedrawMandelbrot()
+	return m, tea.Batch(cmd, redraw)
+}
+
+func (m Model) ViewFormula() string {
+	if m.formulaModel.settings.form != nil {
+		return docStyle.Render(m.formulaModel.settings.form.View())
+	}
+	return docStyle.Render(m.formulaModel.list.View())
+}
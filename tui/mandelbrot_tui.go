@@ -1,12 +1,15 @@
 package tui
 
 import (
+	"context"
 	"fmt"
 	"mandel-cli/kitty"
 	"mandel-cli/mandelbrot"
 	"mandel-cli/utils"
+	"math"
 	"strings"
 
+	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 )
@@ -19,7 +22,28 @@ const (
 	ZoomIn       KeyAction = "zoom_in"
 	ZoomOut      KeyAction = "zoom_out"
 	CycleColor   KeyAction = "cycle_color"
+	CycleAlgo    KeyAction = "cycle_coloring"
 	ToggleSmooth KeyAction = "toggle_smooth"
+	OrbitForm    KeyAction = "orbit_settings"
+	ToggleLight  KeyAction = "toggle_lighting"
+	LightLeft    KeyAction = "light_left"
+	LightRight   KeyAction = "light_right"
+	LightLower   KeyAction = "light_lower"
+	LightHigher  KeyAction = "light_higher"
+	ShiftDown    KeyAction = "shift_palette_down"
+	ShiftUp      KeyAction = "shift_palette_up"
+	DensityDown  KeyAction = "density_down"
+	DensityUp    KeyAction = "density_up"
+	CycleEngine  KeyAction = "cycle_engine"
+	ToggleSeries KeyAction = "toggle_series"
+	CycleTerms   KeyAction = "cycle_terms"
+	Subdivide    KeyAction = "subdivide"
+	ToggleJulia  KeyAction = "toggle_julia"
+	Preview      KeyAction = "toggle_preview"
+	CursorLeft   KeyAction = "cursor_left"
+	CursorRight  KeyAction = "cursor_right"
+	CursorUp     KeyAction = "cursor_up"
+	CursorDown   KeyAction = "cursor_down"
 	IncreaseIter KeyAction = "increase_iter"
 	DecreaseIter KeyAction = "decrease_iter"
 	Reset        KeyAction = "reset"
@@ -27,7 +51,16 @@ const (
 	Quit         KeyAction = "quit"
 	ForceQuit    KeyAction = "force_quit"
 	Hide         KeyAction = "hide"
+	Help         KeyAction = "help"
 	SelectPreset KeyAction = "select_preset"
+	SelectForm   KeyAction = "select_formula"
+	Settings     KeyAction = "settings"
+	ExponentDown KeyAction = "exponent_down"
+	ExponentUp   KeyAction = "exponent_up"
+	RotateLeft   KeyAction = "rotate_left"
+	RotateRight  KeyAction = "rotate_right"
+	RotateUp     KeyAction = "rotate_up"
+	RotateDown   KeyAction = "rotate_down"
 	Save         KeyAction = "save"
 )
 
@@ -41,7 +74,28 @@ var keyBindings = map[KeyAction][]string{
 	ZoomIn:       {"+"},
 	ZoomOut:      {"-"},
 	CycleColor:   {"c"},
+	CycleAlgo:    {"C"},
 	ToggleSmooth: {"s"},
+	OrbitForm:    {"o"},
+	ToggleLight:  {"L"},
+	LightLeft:    {"<"},
+	LightRight:   {">"},
+	LightLower:   {"("},
+	LightHigher:  {")"},
+	ShiftDown:    {"["},
+	ShiftUp:      {"]"},
+	DensityDown:  {"{"},
+	DensityUp:    {"}"},
+	CycleEngine:  {"e"},
+	ToggleSeries: {"a"},
+	CycleTerms:   {"A"},
+	Subdivide:    {"b"},
+	ToggleJulia:  {"J"},
+	Preview:      {"v"},
+	CursorLeft:   {"shift+left"},
+	CursorRight:  {"shift+right"},
+	CursorUp:     {"shift+up"},
+	CursorDown:   {"shift+down"},
 	IncreaseIter: {"i"},
 	DecreaseIter: {"d"},
 	Reset:        {"r"},
@@ -49,7 +103,16 @@ var keyBindings = map[KeyAction][]string{
 	Quit:         {"q"},
 	ForceQuit:    {"ctrl+c"},
 	Hide:         {"m"},
+	Help:         {"?"},
 	SelectPreset: {"p"},
+	SelectForm:   {"f"},
+	Settings:     {"F"},
+	ExponentDown: {"n"},
+	ExponentUp:   {"N"},
+	RotateLeft:   {"alt+h", "alt+left"},
+	RotateRight:  {"alt+l", "alt+right"},
+	RotateUp:     {"alt+k", "alt+up"},
+	RotateDown:   {"alt+j", "alt+down"},
 	Save:         {"ctrl+s"},
 }
 
@@ -60,18 +123,53 @@ var mandelbrotKeyHandlers = map[KeyAction]KeyHandler{
 	MoveDown:     func(m *Model) { m.params.Move(0, MoveStep); m.mandelbortModel.paramsChanged = true },
 	ZoomIn:       func(m *Model) { m.params.ZoomIn(); m.mandelbortModel.paramsChanged = true },
 	ZoomOut:      func(m *Model) { m.params.ZoomOut(); m.mandelbortModel.paramsChanged = true },
-	CycleColor:   func(m *Model) { m.params.CycleColor(); m.mandelbortModel.paramsChanged = true },
-	ToggleSmooth: func(m *Model) { m.params.ToggleSmooth(); m.mandelbortModel.paramsChanged = true },
+	CycleColor:   func(m *Model) { m.params.CycleColor(); m.recolor() },
+	CycleAlgo:    func(m *Model) { m.cycleColoring() },
+	ToggleSmooth: func(m *Model) { m.params.ToggleSmooth(); m.recolor() },
+	OrbitForm:    func(m *Model) { m.showSettings(coloringForm(m.params)) },
+	ToggleLight:  func(m *Model) { m.params.ToggleLighting(); m.recolor() },
+	LightLeft:    func(m *Model) { m.params.RotateLight(LightStep); m.recolor() },
+	LightRight:   func(m *Model) { m.params.RotateLight(-LightStep); m.recolor() },
+	LightLower:   func(m *Model) { m.params.ScaleLightHeight(1 / LightHeightStep); m.recolor() },
+	LightHigher:  func(m *Model) { m.params.ScaleLightHeight(LightHeightStep); m.recolor() },
+	ShiftDown:    func(m *Model) { m.params.ShiftPalette(-PaletteStep); m.recolor() },
+	ShiftUp:      func(m *Model) { m.params.ShiftPalette(PaletteStep); m.recolor() },
+	DensityDown:  func(m *Model) { m.params.ScaleDensity(1 / DensityStep); m.recolor() },
+	DensityUp:    func(m *Model) { m.params.ScaleDensity(DensityStep); m.recolor() },
+	CycleEngine:  func(m *Model) { m.params.CycleEngine(); m.mandelbortModel.paramsChanged = true },
+	ToggleSeries: func(m *Model) { m.params.ToggleSeries(); m.mandelbortModel.paramsChanged = true },
+	CycleTerms:   func(m *Model) { m.params.CycleSeriesTerms(); m.mandelbortModel.paramsChanged = true },
+	Subdivide:    func(m *Model) { m.params.ToggleSubdivide(); m.mandelbortModel.paramsChanged = true },
+	ToggleJulia:  func(m *Model) { m.toggleJulia(); m.mandelbortModel.paramsChanged = true },
+	Preview:      func(m *Model) { m.togglePreview(); m.mandelbortModel.paramsChanged = true },
+	CursorLeft:   func(m *Model) { m.moveCursor(-1, 0) },
+	CursorRight:  func(m *Model) { m.moveCursor(1, 0) },
+	CursorUp:     func(m *Model) { m.moveCursor(0, -1) },
+	CursorDown:   func(m *Model) { m.moveCursor(0, 1) },
 	IncreaseIter: func(m *Model) { m.params.IncreaseIterations(); m.mandelbortModel.paramsChanged = true },
 	DecreaseIter: func(m *Model) { m.params.DecreaseIterations(); m.mandelbortModel.paramsChanged = true },
 	Reset:        func(m *Model) { m.Reset(); m.mandelbortModel.paramsChanged = true },
 	ToggleImg:    func(m *Model) { m.toggleDisplayImg() },
 	Hide:         func(m *Model) { m.toggleHideMenu() },
+	Help:         func(m *Model) { m.mandelbortModel.fullHelp = !m.mandelbortModel.fullHelp },
 	SelectPreset: func(m *Model) {
 		m.view = PresetsView
 		h, v := docStyle.GetFrameSize()
 		m.presetsModel.list.SetSize(m.width-h, m.height-v)
 	},
+	SelectForm: func(m *Model) {
+		m.view = FormulaView
+		h, v := docStyle.GetFrameSize()
+		m.formulaModel.list.SetSize(m.width-h, m.height-v)
+		m.selectFractal()
+	},
+	Settings:     func(m *Model) { m.openSettings(false) },
+	ExponentDown: func(m *Model) { m.params.AdjustExponent(-ExponentStep); m.mandelbortModel.paramsChanged = true },
+	ExponentUp:   func(m *Model) { m.params.AdjustExponent(ExponentStep); m.mandelbortModel.paramsChanged = true },
+	RotateLeft:   func(m *Model) { m.rotate(-RotateStep, 0) },
+	RotateRight:  func(m *Model) { m.rotate(RotateStep, 0) },
+	RotateUp:     func(m *Model) { m.rotate(0, RotateStep) },
+	RotateDown:   func(m *Model) { m.rotate(0, -RotateStep) },
 	Save: func(m *Model) {
 		m.view = PresetsView
 		m.saveModel = initSaveModel(m.params)
@@ -82,6 +180,8 @@ var mandelbrotKeyHandlers = map[KeyAction]KeyHandler{
 var infoReplacer utils.ChainReplacer
 var controls string
 var controlsDisabled string
+var fullControls string
+var fullControlsDisabled string
 
 type MandelbrotModel struct {
 	text          string // Text representation of the Mandelbrot set
@@ -90,12 +190,23 @@ type MandelbrotModel struct {
 	paramsChanged bool   // Whether parameters have changed
 	errorMsg      string // Error message for UI display
 	hideMenu      bool   // Wheter menu should be hidden
+	fullHelp      bool   // Whether all controls are listed instead of the basic ones
+
+	cancelRender context.CancelFunc           // Cancels the render in flight, if any
+	render       renderState                  // Progress of the background render
+	spinner      spinner.Model                // Shown while rendering
+	field        *mandelbrot.IterField        // Last rendered field, recolored on palette changes
+	parentView   *mandelbrot.MandelbrotParams // Mandelbrot view to return to from Julia mode
+	preview      previewState                 // Julia preview pane linked to the cursor
+	textCache    *mandelbrot.IterCache        // Last text frame, reused when panning
 }
 
 func initMandelbrotModel() MandelbrotModel {
 	return MandelbrotModel{
 		hideMenu:      false,
 		paramsChanged: true,
+		spinner:       spinner.New(spinner.WithSpinner(spinner.MiniDot), spinner.WithStyle(progressStyle)),
+		textCache:     &mandelbrot.IterCache{},
 	}
 }
 
@@ -103,106 +214,223 @@ func setupUIConfig() {
 	infoReplacer = *utils.NewReplacer(
 		lipgloss.JoinVertical(
 			lipgloss.Left,
+			lipgloss.JoinHorizontal(lipgloss.Left, labelStyle.Render("Fractal: "), valueStyle.Render(":FRACTAL:")),
+			lipgloss.JoinHorizontal(lipgloss.Left, labelStyle.Render("Formula: "), valueStyle.Render(":FORMULA:")),
 			lipgloss.JoinHorizontal(lipgloss.Left, labelStyle.Render("Center Re: "), valueStyle.Render(":CENTER_RE:")),
 			lipgloss.JoinHorizontal(lipgloss.Left, labelStyle.Render("Center Im: "), valueStyle.Render(":CENTER_IM:")),
 			lipgloss.JoinHorizontal(lipgloss.Left, labelStyle.Render("Zoom: "), valueStyle.Render(":ZOOM:")),
 			lipgloss.JoinHorizontal(lipgloss.Left, labelStyle.Render("Iterations: "), valueStyle.Render(":ITER:")),
 			lipgloss.JoinHorizontal(lipgloss.Left, labelStyle.Render("Color: "), valueStyle.Render(":COLOR:")),
+			lipgloss.JoinHorizontal(lipgloss.Left, labelStyle.Render("Coloring: "), valueStyle.Render(":COLORING:")),
 			lipgloss.JoinHorizontal(lipgloss.Left, labelStyle.Render("Smooth: "), valueStyle.Render(":SMOOTH:")),
+			lipgloss.JoinHorizontal(lipgloss.Left, labelStyle.Render("Lighting: "), valueStyle.Render(":LIGHTING:")),
+			lipgloss.JoinHorizontal(lipgloss.Left, labelStyle.Render("Palette: "), valueStyle.Render(":PALETTE:")),
+			lipgloss.JoinHorizontal(lipgloss.Left, labelStyle.Render("Engine: "), valueStyle.Render(":ENGINE:")),
+			lipgloss.JoinHorizontal(lipgloss.Left, labelStyle.Render("Series: "), valueStyle.Render(":SERIES:")),
+			lipgloss.JoinHorizontal(lipgloss.Left, labelStyle.Render("Skipped: "), valueStyle.Render(":SKIPPED:")),
+			lipgloss.JoinHorizontal(lipgloss.Left, labelStyle.Render("Subdivide: "), valueStyle.Render(":SUBDIVIDE:")),
 		))
 
-	var helpText = []string{
-		"h/j/k/l or arrows: Move",
-		"+/-: Zoom in/out",
-		"c: Cycle color scheme",
-		"s: Toggle smooth coloring",
-		"i/d: +/- max iterations",
-		"r: Reset to default",
-		"p: Select preset",
-		"ctrl+s: Save image",
-		"m: Hide menu",
-		"t: Toggle image/text",
-		"q: Quit",
-	}
-
-	generateControls := func(disableNonToggle bool) string {
-		controlsArr := make([]string, len(helpText))
-		for i, line := range helpText {
-			controlsArr[i] = styleControlLine(line, disableNonToggle && !strings.HasPrefix(line, "t:") && !strings.HasPrefix(line, "q:") && !strings.HasPrefix(line, "m:"))
+	// Only the basic controls are listed until ? expands the help, so the
+	// menu fits the terminal
+	var helpText = []struct {
+		line  string
+		basic bool
+	}{
+		{"h/j/k/l or arrows: Move", true},
+		{"+/-: Zoom in/out", true},
+		{"c: Cycle color scheme", true},
+		{"C: Cycle coloring algorithm", false},
+		{"s: Toggle smooth coloring", true},
+		{"o: Orbit trap/stripe settings", false},
+		{"L: Toggle 3D lighting", false},
+		{"</>: Rotate light", false},
+		{"(/): Light height", false},
+		{"[/]: Shift palette", false},
+		{"{/}: Color density", false},
+		{"e: Cycle render engine", false},
+		{"a/A: Series approx/terms", false},
+		{"b: Toggle subdivision", false},
+		{"i/d: +/- max iterations", true},
+		{"J: Toggle Julia set", false},
+		{"v: Toggle Julia preview", false},
+		{"shift+arrows/mouse: Cursor", false},
+		{"r: Reset to default", true},
+		{"p: Select preset", true},
+		{"f: Select fractal", true},
+		{"F: Fractal settings", false},
+		{"n/N: Multibrot exponent/power", false},
+		{"alt+arrows: Rotate Mandelbulb", false},
+		{"ctrl+s: Save image", true},
+		{"m: Hide menu", true},
+		{"t: Toggle image/text", true},
+		{"q: Quit", true},
+	}
+
+	generateControls := func(disableNonToggle, full bool) string {
+		var controlsArr []string
+		for _, help := range helpText {
+			if full || help.basic {
+				line := help.line
+				controlsArr = append(controlsArr, styleControlLine(line, disableNonToggle && !strings.HasPrefix(line, "t:") && !strings.HasPrefix(line, "q:") && !strings.HasPrefix(line, "m:")))
+			}
 		}
+		controlsArr = append(controlsArr, styleControlLine(utils.Ternary(full, "?: Fewer controls", "?: All controls"), false))
 		return lipgloss.JoinVertical(lipgloss.Left, controlsArr...)
 	}
 
-	controls = generateControls(false)
-	controlsDisabled = generateControls(true)
+	controls = generateControls(false, false)
+	controlsDisabled = generateControls(true, false)
+	fullControls = generateControls(false, true)
+	fullControlsDisabled = generateControls(true, true)
+}
+
+// renderContext cancels any render still in flight and returns the context
+// for the next one, so stale renders never outlive a params change.
+func (m *Model) renderContext() context.Context {
+	if m.mandelbortModel.cancelRender != nil {
+		m.mandelbortModel.cancelRender()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.mandelbortModel.cancelRender = cancel
+	return ctx
 }
 
 func (m *Model) toggleDisplayImg() {
 	m.mandelbortModel.displayImg = !m.mandelbortModel.displayImg
 	m.mandelbortModel.errorMsg = ""
-	if m.mandelbortModel.displayImg {
-		image, err := mandelbrot.GenerateMandelbrotImage(m.params)
-		if err != nil {
-			m.mandelbortModel.errorMsg = fmt.Sprintf("Error generating image: %v", err)
-			m.mandelbortModel.displayImg = false
-			return
-		}
-		m.mandelbortModel.image, err = kitty.Kitty(image, m.params.Width*2, m.params.Height)
-		if err != nil {
-			m.mandelbortModel.errorMsg = fmt.Sprintf("Error rendering kitty image: %v", err)
-			m.mandelbortModel.displayImg = false
-			return
-		}
-		m.mandelbortModel.text = ""
-	} else {
+	if !m.mandelbortModel.displayImg {
 		kitty.KittyClearImages()
 		m.mandelbortModel.image = ""
+	}
+	m.mandelbortModel.paramsChanged = true
+}
+
+// toggleJulia switches to the Julia set of the current center, or back to the
+// Mandelbrot view it was opened from.
+func (m *Model) toggleJulia() {
+	if m.params.Fractal != mandelbrot.FractalMandelbrot && m.params.Fractal != mandelbrot.FractalJulia {
+		return
+	}
+	if m.params.Fractal == mandelbrot.FractalJulia {
+		if parent := m.mandelbortModel.parentView; parent != nil {
+			m.params.Overwrite(*parent)
+		} else {
+			center := m.params
+			center.Fractal = mandelbrot.FractalMandelbrot
+			center.CenterRe = mandelbrot.NewCoord(m.params.JuliaRe)
+			center.CenterIm = mandelbrot.NewCoord(m.params.JuliaIm)
+			center.ZoomFactor = 1.0
+			m.params.Overwrite(center)
+		}
+		m.mandelbortModel.parentView = nil
+		return
+	}
+	parent := m.params
+	m.mandelbortModel.parentView = &parent
+	if preview := m.mandelbortModel.preview; preview.enabled {
+		// Open the Julia set under the cursor rather than the center
+		m.params.JuliaOf(preview.seedRe, preview.seedIm)
+		return
+	}
+	m.params.JuliaAt()
+}
+
+// cycleColoring switches to the next coloring algorithm. Orbit statistics are
+// collected while rendering, so switching to or from them renders again.
+func (m *Model) cycleColoring() {
+	before := m.params.OrbitColoring()
+	m.params.CycleColoring()
+	if before || m.params.OrbitColoring() {
 		m.mandelbortModel.paramsChanged = true
+		return
+	}
+	m.recolor()
+}
+
+// rotate turns the camera around the Mandelbulb, other fractals are flat.
+func (m *Model) rotate(dyaw, dpitch float64) {
+	if m.params.Fractal != mandelbrot.FractalMandelbulb {
+		return
 	}
+	m.params.Rotate(dyaw, dpitch)
+	m.mandelbortModel.paramsChanged = true
 }
 
 func (m *Model) toggleHideMenu() {
 	m.mandelbortModel.hideMenu = !m.mandelbortModel.hideMenu
+	m.resizeFrame()
+	m.mandelbortModel.paramsChanged = true
+}
+
+// resizeFrame fits the frame width to the terminal, next to the menu and
+// Julia preview when they are shown.
+func (m *Model) resizeFrame() {
+	width := m.width
+	if m.mandelbortModel.preview.enabled {
+		width -= 2*m.previewSize() + 1
+	}
 	if m.mandelbortModel.hideMenu {
-		m.params.Width = m.width / 2
+		m.params.Width = width / 2
 	} else {
-		m.params.Width = (m.width-defaultUIConfig.MenuWidth)/2 - WidthAdjustment
+		m.params.Width = (width-defaultUIConfig.MenuWidth)/2 - WidthAdjustment
 	}
-
-	m.mandelbortModel.paramsChanged = true
+	m.params.Height = m.height
 }
 
 func (m Model) ViewMandelbrot() string {
 	if !m.mandelbortModel.hideMenu {
 		info := infoReplacer
 		infoStr := info.
-			Replace(":CENTER_RE:", fmt.Sprintf("%.9f", m.params.CenterRe)).
-			Replace(":CENTER_IM:", fmt.Sprintf("%.9f", m.params.CenterIm)).
-			Replace(":ZOOM:", fmt.Sprintf("%.9f", m.params.ZoomFactor)).
+			Replace(":FRACTAL:", m.viewFractal()).
+			Replace(":FORMULA:", m.viewFormula()).
+			Replace(":CENTER_RE:", mandelbrot.FormatCoord(m.params.CenterRe, m.params.ZoomFactor)).
+			Replace(":CENTER_IM:", mandelbrot.FormatCoord(m.params.CenterIm, m.params.ZoomFactor)).
+			Replace(":ZOOM:", utils.Ternary(m.params.ZoomFactor >= 1e-6, fmt.Sprintf("%.9f", m.params.ZoomFactor), fmt.Sprintf("%.6e", m.params.ZoomFactor))).
 			Replace(":ITER:", fmt.Sprintf("%d", m.params.MaxIter)).
 			Replace(":COLOR:", mandelbrot.ColorNames[m.params.ColorMode]).
+			Replace(":COLORING:", m.viewColoring()).
 			Replace(":SMOOTH:", fmt.Sprintf("%v", m.params.Smooth)).
+			Replace(":LIGHTING:", utils.Ternary(m.params.Lighting, fmt.Sprintf("%.0f°, height %.2g", m.params.LightAngle*180/math.Pi, m.params.LightHeight), "off")).
+			Replace(":PALETTE:", fmt.Sprintf("+%.2f, x%.2f", m.params.ColorOffset, m.params.ColorDensity)).
+			Replace(":ENGINE:", mandelbrot.EngineNames[m.params.Engine]).
+			Replace(":SKIPPED:", m.viewStats()).
+			Replace(":SUBDIVIDE:", m.viewSubdivide()).
+			Replace(":SERIES:", utils.Ternary(m.params.SeriesApprox, fmt.Sprintf("on (%d terms)", m.params.SeriesTerms), "off")).
 			String()
 
-		errorStr := ""
+		// Status lines go above the controls, which can run past the
+		// bottom of small terminals
+		var status []string
+		for _, line := range []string{m.viewRenderStatus(), m.viewPrecisionWarning()} {
+			if line != "" {
+				status = append(status, line)
+			}
+		}
 		if m.mandelbortModel.errorMsg != "" {
-			errorStr = errorStyle.Render("Error: " + m.mandelbortModel.errorMsg)
+			status = append(status, errorStyle.Render("Error: "+m.mandelbortModel.errorMsg))
+		}
+		statusStr := lipgloss.JoinVertical(lipgloss.Left, status...)
+
+		help := utils.Ternary(m.mandelbortModel.fullHelp, fullControls, controls)
+		if m.mandelbortModel.displayImg {
+			help = utils.Ternary(m.mandelbortModel.fullHelp, fullControlsDisabled, controlsDisabled)
 		}
 
 		menuContent := lipgloss.JoinVertical(
 			lipgloss.Left,
 			"",
 			headerStyle.Render("Parameters:"),
-			lipgloss.NewStyle().Padding(0, 0, 1, 0).Render(infoStr),
+			infoStr,
+			lipgloss.NewStyle().Padding(0, 0, 1, 0).Render(statusStr),
 			headerStyle.Render("Controls:"),
-			helpStyle.Render(utils.Ternary(m.mandelbortModel.displayImg, controlsDisabled, controls)),
-			errorStr,
+			helpStyle.Render(help),
 		)
 
 		mandelbrotPanel := mandelbrotStyle.
 			Width(m.width - defaultUIConfig.MenuWidth - MenuPadding).
 			Height(m.height - 2).
-			Render(utils.Ternary(m.mandelbortModel.displayImg, utils.PadEmptyLines(m.mandelbortModel.image, m.params.Height), m.mandelbortModel.text))
+			Render(m.viewSplit())
 
 		menuPanel := panelStyle.Render(menuContent)
 
@@ -213,11 +441,114 @@ func (m Model) ViewMandelbrot() string {
 			menuPanel,
 		)
 	} else {
-		return utils.Ternary(m.mandelbortModel.displayImg, utils.PadEmptyLines(m.mandelbortModel.image, m.params.Height), m.mandelbortModel.text)
+		return m.viewSplit()
+	}
+}
+
+// viewSplit places the Julia preview next to the frame when it is enabled.
+func (m Model) viewSplit() string {
+	if !m.mandelbortModel.preview.enabled {
+		return m.viewFrame()
+	}
+	return lipgloss.JoinHorizontal(lipgloss.Top, m.viewFrame(), " ", m.viewPreview())
+}
+
+// viewFractal names the fractal type, with the seed for Julia sets.
+func (m Model) viewFractal() string {
+	name := mandelbrot.FractalNames[m.params.Fractal]
+	if m.params.Fractal == mandelbrot.FractalJulia {
+		return fmt.Sprintf("%s %.4g%+.4gi", name, m.params.JuliaRe, m.params.JuliaIm)
+	}
+	return name
+}
+
+// viewFormula names the formula, with the exponent for Multibrot.
+func (m Model) viewFormula() string {
+	switch m.params.Fractal {
+	case mandelbrot.FractalNewton:
+		return m.params.Roots
+	case mandelbrot.FractalBuddhabrot, mandelbrot.FractalNebulabrot:
+		return fmt.Sprintf("%d samples/px, seed %d", m.params.Samples, m.params.Seed)
+	case mandelbrot.FractalLyapunov:
+		return "Sequence " + m.params.Sequence
+	case mandelbrot.FractalMandelbulb:
+		cam := m.params.Camera
+		return fmt.Sprintf("Power %g, yaw %.0f°, pitch %.0f°", m.params.Power, cam.Yaw*180/math.Pi, cam.Pitch*180/math.Pi)
+	}
+	name := mandelbrot.FormulaNames[m.params.Formula]
+	switch m.params.Formula {
+	case mandelbrot.FormulaMultibrot:
+		return fmt.Sprintf("%s z^%g", name, m.params.Exponent)
+	case mandelbrot.FormulaCustom:
+		return m.params.Expression
+	}
+	return name
+}
+
+// viewColoring names the coloring algorithm, with the shape for orbit traps
+// and the density for stripes.
+func (m Model) viewColoring() string {
+	name := mandelbrot.ColoringNames[m.params.Coloring]
+	switch m.params.Coloring {
+	case mandelbrot.ColoringOrbitTrap:
+		return fmt.Sprintf("%s (%s)", name, mandelbrot.TrapNames[m.params.Trap.Shape])
+	case mandelbrot.ColoringStripe:
+		return fmt.Sprintf("%s x%g", name, m.params.StripeDensity)
 	}
+	return name
+}
+
+// viewStats summarizes how many pixels of the last frame were short-circuited.
+func (m Model) viewStats() string {
+	if m.mandelbortModel.field == nil {
+		return "-"
+	}
+	stats := m.mandelbortModel.field.Stats
+	if stats.Pixels == 0 {
+		return "-"
+	}
+	pixels := float64(stats.Pixels)
+	return fmt.Sprintf("%.0f%% bulb, %.0f%% cycle", 100*float64(stats.Bulb)/pixels, 100*float64(stats.Periodic)/pixels)
+}
+
+// viewPrecisionWarning warns when the last frame needed more precision than
+// its fractal can be iterated with.
+func (m Model) viewPrecisionWarning() string {
+	if field := m.mandelbortModel.field; field == nil || !field.Imprecise {
+		return ""
+	}
+	return errorStyle.Render("Warning: zoomed past float64, only Mandelbrot z² + c and its Julia sets go deeper")
+}
+
+// viewSubdivide shows whether subdivision is on and how much of the last
+// frame it filled.
+func (m Model) viewSubdivide() string {
+	if !m.params.Subdivide {
+		return "off"
+	}
+	field := m.mandelbortModel.field
+	if field == nil || field.Stats.Pixels == 0 {
+		return "on"
+	}
+	return fmt.Sprintf("on (%.0f%% filled)", 100*float64(field.Stats.Filled)/float64(field.Stats.Pixels))
+}
+
+// viewFrame returns the last finished frame, keeping the text frame on screen
+// until the first image is ready.
+func (m Model) viewFrame() string {
+	if m.mandelbortModel.displayImg && m.mandelbortModel.image != "" {
+		return utils.PadEmptyLines(m.mandelbortModel.image, m.params.Height)
+	}
+	if preview := m.mandelbortModel.preview; preview.enabled && m.params.Fractal == mandelbrot.FractalMandelbrot {
+		return drawCursor(m.mandelbortModel.text, preview.cursorX, preview.cursorY)
+	}
+	return m.mandelbortModel.text
 }
 
 func (m Model) UpdateMandelbrot(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.MouseMsg); ok && !m.mandelbortModel.displayImg {
+		m.updateMouse(msg)
+	}
 	if msg, ok := msg.(tea.KeyMsg); ok {
 		key := msg.String()
 		for action, keys := range keyBindings {
@@ -226,7 +557,7 @@ func (m Model) UpdateMandelbrot(msg tea.Msg) (tea.Model, tea.Cmd) {
 					if action == Quit {
 						return m, tea.Quit
 					}
-					if !m.mandelbortModel.displayImg || action == ToggleImg || action == Hide {
+					if !m.mandelbortModel.displayImg || action == ToggleImg || action == Hide || action == Help {
 						mandelbrotKeyHandlers[action](&m)
 					}
 					break
@@ -234,6 +565,6 @@ func (m Model) UpdateMandelbrot(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		}
 	}
-	m.RedrawMandelbrot()
-	return m, nil
+	cmd := m.RedrawMandelbrot()
+	return m, cmd
 }
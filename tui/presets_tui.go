@@ -12,17 +12,76 @@ import (
 
 var presets = map[string]mandelbrot.MandelbrotParams{
 	"Julia Island": {
-		CenterRe:   -1.768778770,
-		CenterIm:   -0.001738942,
+		CenterRe:   mandelbrot.MustParseCoord("-1.768778770"),
+		CenterIm:   mandelbrot.MustParseCoord("-0.001738942"),
 		ZoomFactor: 0.000000340,
 		MaxIter:    400,
 	},
 	"Seahorse Valley": {
-		CenterRe:   -0.743517833,
-		CenterIm:   -0.127094578,
+		CenterRe:   mandelbrot.MustParseCoord("-0.743517833"),
+		CenterIm:   mandelbrot.MustParseCoord("-0.127094578"),
 		ZoomFactor: 0.004228283,
 		MaxIter:    400,
 	},
+	"Douady Rabbit": {
+		CenterRe:   mandelbrot.NewCoord(0),
+		CenterIm:   mandelbrot.NewCoord(0),
+		ZoomFactor: 1.0,
+		MaxIter:    200,
+		Fractal:    mandelbrot.FractalJulia,
+		JuliaRe:    -0.123,
+		JuliaIm:    0.745,
+	},
+	"Dendrite": {
+		CenterRe:   mandelbrot.NewCoord(0),
+		CenterIm:   mandelbrot.NewCoord(0),
+		ZoomFactor: 1.0,
+		MaxIter:    200,
+		Fractal:    mandelbrot.FractalJulia,
+		JuliaRe:    0,
+		JuliaIm:    1,
+	},
+	"Newton z³ - 1": {
+		CenterRe:   mandelbrot.NewCoord(0),
+		CenterIm:   mandelbrot.NewCoord(0),
+		ZoomFactor: 1.0,
+		MaxIter:    100,
+		Fractal:    mandelbrot.FractalNewton,
+		Roots:      mandelbrot.DefaultRoots,
+	},
+	"Newton z⁴ - 1": {
+		CenterRe:   mandelbrot.NewCoord(0),
+		CenterIm:   mandelbrot.NewCoord(0),
+		ZoomFactor: 1.0,
+		MaxIter:    100,
+		Fractal:    mandelbrot.FractalNewton,
+		Roots:      "1, i, -1, -i",
+	},
+	"Newton z³ - 2z + 2": {
+		CenterRe:   mandelbrot.NewCoord(0),
+		CenterIm:   mandelbrot.NewCoord(0),
+		ZoomFactor: 1.0,
+		MaxIter:    100,
+		Fractal:    mandelbrot.FractalNewton,
+		Roots:      "-1.769292, 0.884646+0.589742i, 0.884646-0.589742i",
+	},
+	"Zircon Zity": {
+		CenterRe:   mandelbrot.MustParseCoord("3.7"),
+		CenterIm:   mandelbrot.MustParseCoord("2.95"),
+		ZoomFactor: 0.185,
+		MaxIter:    200,
+		Fractal:    mandelbrot.FractalLyapunov,
+		Sequence:   "BBBBBBAAAAAA",
+	},
+}
+
+// presetPalettes are the color schemes of presets, by name so user palettes
+// can be used too. Presets without one keep the current colors.
+var presetPalettes = map[string]string{
+	"Julia Island":    "Classic",
+	"Seahorse Valley": "Classic",
+	"Dendrite":        "Sunset",
+	"Zircon Zity":     "Fire",
 }
 
 var docStyle = lipgloss.NewStyle().Margin(1, 2)
@@ -54,10 +113,21 @@ type PresetsModel struct {
 func initPresetsModel() PresetsModel {
 	items := make([]list.Item, 0, len(presets))
 	for preset := range presets {
-		items = append(items, item{
-			title: preset,
-			desc:  fmt.Sprintf("Real: %v, Imaginary: %v", presets[preset].CenterRe, presets[preset].CenterIm),
-		})
+		p := presets[preset]
+		desc := fmt.Sprintf("Real: %s, Imaginary: %s",
+			mandelbrot.FormatCoord(p.CenterRe, p.ZoomFactor), mandelbrot.FormatCoord(p.CenterIm, p.ZoomFactor))
+		switch p.Fractal {
+		case mandelbrot.FractalJulia:
+			desc = fmt.Sprintf("Julia seed: %v, %v", p.JuliaRe, p.JuliaIm)
+		case mandelbrot.FractalNewton:
+			desc = "Newton roots: " + p.Roots
+		case mandelbrot.FractalLyapunov:
+			desc = "Lyapunov sequence: " + p.Sequence
+		}
+		if palette, ok := presetPalettes[preset]; ok {
+			desc += ", colors: " + palette
+		}
+		items = append(items, item{title: preset, desc: desc})
 	}
 
 	delegate := list.NewDefaultDelegate()
@@ -86,6 +156,10 @@ func (m Model) UpdatePresets(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "enter":
 			if selected, ok := m.presetsModel.list.SelectedItem().(item); ok {
 				m.params.Overwrite(presets[selected.title])
+				m.mandelbortModel.parentView = nil
+				if scheme, ok := mandelbrot.SchemeIndex(presetPalettes[selected.title]); ok {
+					m.params.ColorMode = scheme
+				}
 				m.view = MandelbrotView
 				m.mandelbortModel.paramsChanged = true
 			}
@@ -96,8 +170,8 @@ func (m Model) UpdatePresets(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	var cmd tea.Cmd
 	m.presetsModel.list, cmd = m.presetsModel.list.Update(msg)
-	m.RedrawMandelbrot()
-	return m, cmd
+	redraw := m.RedrawMandelbrot()
+	return m, tea.Batch(cmd, redraw)
 }
 
 func (m Model) ViewPresets() string {
@@ -0,0 +1,169 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mandel-cli/mandelbrot"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// cursorCell replaces the text pixel under the Julia preview cursor.
+const cursorCell = "\033[48;2;255;255;255m\033[38;2;0;0;0m<>\033[0m"
+
+// previewMsg carries a finished Julia preview render.
+type previewMsg struct {
+	id    int
+	field *mandelbrot.IterField
+	err   error
+}
+
+// previewState tracks the Julia preview pane linked to the cursor.
+type previewState struct {
+	enabled        bool
+	changed        bool // Whether the cursor moved since the last preview
+	cursorX        int  // Cursor position, in text pixels of the main frame
+	cursorY        int
+	seedRe, seedIm float64 // Point under the cursor
+	id             int     // Id of the latest preview, older results are dropped
+	cancel         context.CancelFunc
+	field          *mandelbrot.IterField
+	text           string
+}
+
+// previewSize returns the width and height in text pixels of the preview.
+func (m Model) previewSize() int {
+	return max(4, min(m.height/2, m.width/6))
+}
+
+// togglePreview shows or hides the Julia preview, starting with the cursor
+// in the middle of the frame.
+func (m *Model) togglePreview() {
+	p := &m.mandelbortModel.preview
+	p.enabled = !p.enabled
+	if p.enabled {
+		p.cursorX, p.cursorY = m.params.Width/2, m.params.Height/2
+		p.changed = true
+	} else if p.cancel != nil {
+		p.cancel()
+	}
+	m.resizeFrame()
+}
+
+// moveCursor moves the preview cursor by dx, dy text pixels, keeping it
+// inside the frame.
+func (m *Model) moveCursor(dx, dy int) {
+	m.setCursor(m.mandelbortModel.preview.cursorX+dx, m.mandelbortModel.preview.cursorY+dy)
+}
+
+// setCursor places the preview cursor at text pixel (x, y).
+func (m *Model) setCursor(x, y int) {
+	p := &m.mandelbortModel.preview
+	if !p.enabled {
+		return
+	}
+	p.cursorX = max(0, min(m.params.Width-1, x))
+	p.cursorY = max(0, min(m.params.Height-1, y))
+	p.changed = true
+}
+
+// updateMouse moves the preview cursor to where the frame is clicked or dragged.
+func (m *Model) updateMouse(msg tea.MouseMsg) {
+	if msg.Button != tea.MouseButtonLeft || msg.Action == tea.MouseActionRelease {
+		return
+	}
+	x, y := msg.X/2, msg.Y
+	if x < m.params.Width && y < m.params.Height {
+		m.setCursor(x, y)
+	}
+}
+
+// startPreview renders the Julia set of the point under the cursor in the
+// background, cancelling the previous preview.
+func (m *Model) startPreview() tea.Cmd {
+	p := &m.mandelbortModel.preview
+	p.changed = false
+	if p.cancel != nil {
+		p.cancel()
+	}
+	if m.params.Fractal != mandelbrot.FractalMandelbrot {
+		p.field = nil
+		p.text = ""
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.id++
+	id := p.id
+
+	re, im := m.params.PixelCoord(p.cursorX, p.cursorY, m.params.Width, m.params.Height)
+	p.seedRe, _ = re.Float64()
+	p.seedIm, _ = im.Float64()
+	params := m.previewParams()
+
+	return func() tea.Msg {
+		field, err := mandelbrot.RenderField(ctx, params, params.Width, params.Height)
+		return previewMsg{id: id, field: field, err: err}
+	}
+}
+
+// previewParams returns the params of the Julia preview for the point under
+// the cursor, sharing coloring and iterations with the main view.
+func (m Model) previewParams() mandelbrot.MandelbrotParams {
+	params := m.params
+	params.JuliaOf(m.mandelbortModel.preview.seedRe, m.mandelbortModel.preview.seedIm)
+	params.Width = m.previewSize()
+	params.Height = m.previewSize()
+	params.Engine = mandelbrot.EngineDirect
+	return params
+}
+
+// updatePreview shows a finished preview.
+func (m Model) updatePreview(msg previewMsg) (tea.Model, tea.Cmd) {
+	p := &m.mandelbortModel.preview
+	if msg.id != p.id || errors.Is(msg.err, context.Canceled) {
+		return m, nil
+	}
+	if msg.err != nil {
+		m.mandelbortModel.errorMsg = fmt.Sprintf("Error rendering preview: %v", msg.err)
+		return m, nil
+	}
+	p.field = msg.field
+	m.recolorPreview()
+	return m, nil
+}
+
+// recolorPreview applies the current coloring to the last preview field.
+func (m *Model) recolorPreview() {
+	p := &m.mandelbortModel.preview
+	if p.field == nil {
+		return
+	}
+	p.text = colorizeText(m.previewParams(), p.field)
+}
+
+// viewPreview renders the preview pane with the seed below it.
+func (m Model) viewPreview() string {
+	p := m.mandelbortModel.preview
+	if m.params.Fractal != mandelbrot.FractalMandelbrot {
+		return valueStyle.Render("Preview needs Mandelbrot")
+	}
+	return p.text + "\n" + valueStyle.Render(fmt.Sprintf("c = %.6g%+.6gi", p.seedRe, p.seedIm))
+}
+
+// drawCursor replaces the text pixel at (x, y) of frame with the cursor.
+func drawCursor(frame string, x, y int) string {
+	lines := strings.Split(frame, "\n")
+	if y >= len(lines) {
+		return frame
+	}
+	cells := strings.SplitAfter(lines[y], "\033[0m")
+	if x >= len(cells) || cells[x] == "" {
+		return frame
+	}
+	cells[x] = cursorCell
+	lines[y] = strings.Join(cells, "")
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,240 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mandel-cli/kitty"
+	"mandel-cli/mandelbrot"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// renderProgressMsg reports how far the render with the given id has come.
+type renderProgressMsg struct {
+	id          int
+	done, total int
+	updates     chan tea.Msg
+}
+
+// renderFrameMsg carries a finished pass of the render with the given id.
+type renderFrameMsg struct {
+	id      int
+	pass    int
+	field   *mandelbrot.IterField  // Escape-time data, kept for recoloring
+	colors  mandelbrot.ColorParams // Coloring the frame was rendered with
+	text    string                 // Text frame, set in text mode
+	image   string                 // Kitty escape sequence, set in image mode
+	updates chan tea.Msg
+}
+
+// renderDoneMsg reports that the render with the given id has finished.
+type renderDoneMsg struct {
+	id      int
+	err     error
+	elapsed time.Duration
+}
+
+// renderState tracks the background render shown in the menu panel.
+type renderState struct {
+	id          int       // Id of the latest render, older results are dropped
+	active      bool      // Whether a render is in flight
+	pass        int       // Number of passes shown so far
+	done, total int       // Jobs finished / total of the current pass
+	started     time.Time // When the current render started
+	elapsed     time.Duration
+}
+
+// waitForRender waits for the next message of a background render.
+func waitForRender(updates chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		return <-updates
+	}
+}
+
+// startRender cancels the render in flight and starts a new one for the
+// current params in the background. The previous frame stays on screen until
+// the new one is done.
+func (m *Model) startRender() tea.Cmd {
+	ctx := m.renderContext()
+	params := m.params
+	displayImg := m.mandelbortModel.displayImg
+
+	started := time.Now()
+
+	m.mandelbortModel.render.id++
+	id := m.mandelbortModel.render.id
+	wasActive := m.mandelbortModel.render.active
+	m.mandelbortModel.render.active = true
+	m.mandelbortModel.render.pass = 0
+	m.mandelbortModel.render.done = 0
+	m.mandelbortModel.render.total = 0
+	m.mandelbortModel.render.started = started
+
+	if !displayImg { // The view can't be moved in image mode
+		ctx = mandelbrot.WithCache(ctx, m.mandelbortModel.textCache)
+	}
+
+	updates := make(chan tea.Msg, 1)
+	ctx = mandelbrot.WithProgress(ctx, func(done, total int) {
+		select {
+		case updates <- renderProgressMsg{id: id, done: done, total: total, updates: updates}:
+		default: // Drop updates while the UI is busy
+		}
+	})
+
+	go func() {
+		pass := 0
+		send := func(frame renderFrameMsg) {
+			pass++
+			frame.id, frame.pass, frame.updates = id, pass, updates
+			updates <- frame
+		}
+		var err error
+		if displayImg {
+			err = renderImage(ctx, params, send)
+		} else {
+			err = renderText(ctx, params, send)
+		}
+		updates <- renderDoneMsg{id: id, err: err, elapsed: time.Since(started)}
+	}()
+
+	if wasActive {
+		return waitForRender(updates)
+	}
+	return tea.Batch(waitForRender(updates), m.mandelbortModel.spinner.Tick)
+}
+
+func renderText(ctx context.Context, params mandelbrot.MandelbrotParams, send func(renderFrameMsg)) error {
+	return mandelbrot.RenderProgressive(ctx, params, params.Width, params.Height, func(field *mandelbrot.IterField) error {
+		send(renderFrameMsg{field: field, colors: params.ColorParams, text: colorizeText(params, field)})
+		return nil
+	})
+}
+
+func renderImage(ctx context.Context, params mandelbrot.MandelbrotParams, send func(renderFrameMsg)) error {
+	imgWidth, imgHeight := mandelbrot.PreviewImageSize(params)
+	return mandelbrot.RenderProgressive(ctx, params, imgWidth, imgHeight, func(field *mandelbrot.IterField) error {
+		image, err := colorizeImage(ctx, params, field)
+		if err != nil {
+			return err
+		}
+		send(renderFrameMsg{field: field, colors: params.ColorParams, image: image})
+		return nil
+	})
+}
+
+func colorizeText(params mandelbrot.MandelbrotParams, field *mandelbrot.IterField) string {
+	return mandelbrot.BufferToString(mandelbrot.ColorizeText(params, field))
+}
+
+func colorizeImage(ctx context.Context, params mandelbrot.MandelbrotParams, field *mandelbrot.IterField) (string, error) {
+	image, err := mandelbrot.EncodeImage(ctx, params, field)
+	if err != nil {
+		return "", fmt.Errorf("generating image: %w", err)
+	}
+	frame, err := kitty.Kitty(image, params.Width*2, params.Height)
+	if err != nil {
+		return "", fmt.Errorf("rendering kitty image: %w", err)
+	}
+	return frame, nil
+}
+
+// recolor applies the current coloring to the last field without rendering
+// it again. Without a field, or when the field lacks what the coloring needs,
+// it falls back to a full render.
+func (m *Model) recolor() {
+	m.recolorPreview()
+	field := m.mandelbortModel.field
+	if field == nil || !field.Supports(m.params.ColorParams) {
+		m.mandelbortModel.paramsChanged = true
+		return
+	}
+	if !m.mandelbortModel.displayImg {
+		m.mandelbortModel.text = colorizeText(m.params, field)
+		return
+	}
+	image, err := colorizeImage(context.Background(), m.params, field)
+	if err != nil {
+		m.mandelbortModel.errorMsg = err.Error()
+		return
+	}
+	m.mandelbortModel.image = image
+}
+
+// updateRender handles messages of background renders.
+func (m Model) updateRender(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case renderProgressMsg:
+		if msg.id == m.mandelbortModel.render.id {
+			m.mandelbortModel.render.done = msg.done
+			m.mandelbortModel.render.total = msg.total
+		}
+		// Keep draining, even for stale renders, so their goroutine can finish
+		return m, waitForRender(msg.updates)
+
+	case renderFrameMsg:
+		if msg.id == m.mandelbortModel.render.id {
+			m.mandelbortModel.render.pass = msg.pass
+			m.mandelbortModel.field = msg.field
+			if msg.colors != m.params.ColorParams {
+				// Coloring changed while the frame was rendering
+				m.recolor()
+			} else if m.mandelbortModel.displayImg {
+				m.mandelbortModel.image = msg.image
+			} else {
+				m.mandelbortModel.text = msg.text
+			}
+		}
+		return m, waitForRender(msg.updates)
+
+	case renderDoneMsg:
+		if msg.id != m.mandelbortModel.render.id {
+			return m, nil
+		}
+		m.mandelbortModel.render.active = false
+		m.mandelbortModel.render.elapsed = msg.elapsed
+		if errors.Is(msg.err, context.Canceled) {
+			return m, nil
+		}
+		if msg.err != nil {
+			var cmd tea.Cmd
+			if m.mandelbortModel.displayImg {
+				m.toggleDisplayImg() // Fall back to text
+				cmd = m.RedrawMandelbrot()
+			}
+			m.mandelbortModel.errorMsg = fmt.Sprintf("Error rendering: %v", msg.err)
+			return m, cmd
+		}
+	}
+	return m, nil
+}
+
+// viewRenderStatus renders the spinner and progress bar while a render is in
+// flight, and the duration of the last render otherwise.
+func (m Model) viewRenderStatus() string {
+	r := m.mandelbortModel.render
+	if !r.active {
+		if r.elapsed == 0 {
+			return ""
+		}
+		return valueStyle.Render(fmt.Sprintf(" Rendered in %v", r.elapsed.Round(time.Millisecond)))
+	}
+
+	return fmt.Sprintf("%s%s %s",
+		m.mandelbortModel.spinner.View(),
+		progressStyle.Render(progressBar(r.done, r.total)),
+		valueStyle.Render(fmt.Sprintf("pass %d, %v", r.pass+1, time.Since(r.started).Round(100*time.Millisecond))))
+}
+
+// progressBar draws done out of total jobs as a bar of fixed width.
+func progressBar(done, total int) string {
+	const barWidth = 10
+	filled := 0
+	if total > 0 {
+		filled = barWidth * done / total
+	}
+	return strings.Repeat("█", filled) + strings.Repeat("░", barWidth-filled)
+}
@@ -2,14 +2,16 @@ package tui
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"image"
 	"image/png"
-	"log"
 	"mandel-cli/mandelbrot"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/huh"
 )
@@ -33,6 +35,30 @@ type SaveModel struct {
 	form      *huh.Form
 	errorMsg  string
 	completed bool
+	save      saveState
+	spinner   spinner.Model
+}
+
+// saveState tracks the image being rendered and written in the background.
+type saveState struct {
+	active      bool
+	file        string
+	done, total int       // Jobs finished / total of the current pass
+	started     time.Time // When the save started
+	cancel      context.CancelFunc
+	updates     chan tea.Msg // Channel of the save in flight, older saves are dropped
+}
+
+// saveProgressMsg reports how far the save sending on updates has come.
+type saveProgressMsg struct {
+	done, total int
+	updates     chan tea.Msg
+}
+
+// saveDoneMsg reports that the save sending on updates has finished.
+type saveDoneMsg struct {
+	err     error
+	updates chan tea.Msg
 }
 
 func initSaveModel(params mandelbrot.MandelbrotParams) SaveModel {
@@ -45,12 +71,20 @@ func initSaveModel(params mandelbrot.MandelbrotParams) SaveModel {
 		}
 	}
 
-	// Initialize color options
+	// Initialize color options, built-in schemes followed by palettes
 	var colorOptions []huh.Option[string]
-	for _, color := range mandelbrot.ColorNames {
+	for i := range mandelbrot.SchemeCount() {
+		color := mandelbrot.ColorNames[i]
 		colorOptions = append(colorOptions, huh.NewOption(color, color))
 	}
 
+	// Initialize coloring algorithm options
+	var coloringOptions []huh.Option[int]
+	for i := range mandelbrot.ColoringCount {
+		coloringOptions = append(coloringOptions, huh.NewOption(mandelbrot.ColoringNames[i], i))
+	}
+	coloring := params.Coloring
+
 	// Initialize resolution options for select field
 	var resOptions []huh.Option[string]
 	for _, res := range resolutionOptions {
@@ -75,6 +109,11 @@ func initSaveModel(params mandelbrot.MandelbrotParams) SaveModel {
 				Key("color").
 				Options(colorOptions...).
 				Value(&colorStr),
+			huh.NewSelect[int]().
+				Title("Coloring").
+				Key("coloring").
+				Options(coloringOptions...).
+				Value(&coloring),
 			huh.NewFilePicker().
 				Title("File Path").
 				Key("filepath").
@@ -98,12 +137,23 @@ func initSaveModel(params mandelbrot.MandelbrotParams) SaveModel {
 		form:      form,
 		errorMsg:  "",
 		completed: false,
+		spinner:   spinner.New(spinner.WithSpinner(spinner.MiniDot), spinner.WithStyle(progressStyle)),
 	}
 }
 
 func (m Model) UpdateSave(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if m.saveModel.save.active {
+			if msg.String() == "esc" {
+				// Cancel the save but keep the form, so it can be sent again
+				m.saveModel.save.cancel()
+				m.saveModel.save = saveState{}
+				m.saveModel.errorMsg = "Save canceled"
+				m.saveModel.retry()
+			}
+			return m, nil
+		}
 		switch msg.String() {
 		case "esc", "q":
 			m.view = MandelbrotView
@@ -132,8 +182,9 @@ func (m Model) UpdateSave(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.saveModel.completed = true
 			resolution := m.saveModel.form.GetString("resolution")
 			filepath := m.saveModel.form.GetString("filepath")
-			filename := m.saveModel.form.GetString("filepath")
+			filename := m.saveModel.form.GetString("filename")
 			color := m.saveModel.form.GetString("color")
+			coloring, _ := m.saveModel.form.Get("coloring").(int)
 
 			// Find selected resolution's width and height
 			var width, height int
@@ -146,7 +197,7 @@ func (m Model) UpdateSave(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			if width == 0 || height == 0 {
 				m.saveModel.errorMsg = "Invalid resolution selected"
-				m.saveModel.completed = false
+				m.saveModel.retry()
 				return m, nil
 			}
 
@@ -154,45 +205,100 @@ func (m Model) UpdateSave(msg tea.Msg) (tea.Model, tea.Cmd) {
 			saveParams := m.params
 			saveParams.Width = width
 			saveParams.Height = height
-			for i, name := range mandelbrot.ColorNames {
-				if name == color {
-					saveParams.ColorMode = i
-					break
-				}
-			}
-
-			// Generate and save the image
-			img, err := mandelbrot.GenerateFixedMandelbrotImage(saveParams, saveParams.Width, saveParams.Height)
-			if err != nil {
-				m.saveModel.errorMsg = fmt.Sprintf("Error generating image: %v", err)
-				m.saveModel.completed = false
-				return m, nil
+			saveParams.Coloring = coloring
+			if i, ok := mandelbrot.SchemeIndex(color); ok {
+				saveParams.ColorMode = i
 			}
 
 			file := filepath + "/" + filename
 			if !strings.HasSuffix(strings.ToLower(file), ".png") {
 				file = file + ".png"
 			}
-			err = SaveImage(img, file)
-			if err != nil {
-				m.saveModel.errorMsg = fmt.Sprintf("Error saving image: %v", err)
-				m.saveModel.completed = false
-				return m, nil
-			}
-
-			// Switch back to Mandelbrot view after successful save
-			m.view = MandelbrotView
-			m.saveModel = initSaveModel(m.params) // Reset form
-			m.saveModel.errorMsg = ""
+			return m, tea.Batch(cmd, m.startSave(saveParams, file))
 		}
 	}
 
 	return m, cmd
 }
 
+// retry hands the completed form back to the user after a failed save.
+func (s *SaveModel) retry() {
+	s.completed = false
+	s.form.State = huh.StateNormal
+}
+
+// startSave generates the image for params and writes it to file in the
+// background.
+func (m *Model) startSave(params mandelbrot.MandelbrotParams, file string) tea.Cmd {
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := make(chan tea.Msg, 1)
+	ctx = mandelbrot.WithProgress(ctx, func(done, total int) {
+		select {
+		case updates <- saveProgressMsg{done: done, total: total, updates: updates}:
+		default: // Drop updates while the UI is busy
+		}
+	})
+	m.saveModel.errorMsg = ""
+	m.saveModel.save = saveState{
+		active:  true,
+		file:    file,
+		started: time.Now(),
+		cancel:  cancel,
+		updates: updates,
+	}
+
+	go func() {
+		img, err := mandelbrot.GenerateFixedMandelbrotImage(ctx, params, params.Width, params.Height)
+		if err != nil {
+			err = fmt.Errorf("generating image: %w", err)
+		} else if err = SaveImage(img, file); err != nil {
+			err = fmt.Errorf("saving image: %w", err)
+		}
+		updates <- saveDoneMsg{err: err, updates: updates}
+	}()
+
+	return tea.Batch(waitForRender(updates), m.saveModel.spinner.Tick)
+}
+
+// updateSaving handles messages of background saves.
+func (m Model) updateSaving(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case saveProgressMsg:
+		if msg.updates == m.saveModel.save.updates {
+			m.saveModel.save.done = msg.done
+			m.saveModel.save.total = msg.total
+		}
+		// Keep draining, even for canceled saves, so their goroutine can finish
+		return m, waitForRender(msg.updates)
+
+	case saveDoneMsg:
+		if msg.updates != m.saveModel.save.updates {
+			return m, nil
+		}
+		m.saveModel.save.cancel()
+		m.saveModel.save = saveState{}
+		if msg.err != nil {
+			m.saveModel.errorMsg = msg.err.Error()
+			m.saveModel.retry()
+			return m, nil
+		}
+
+		// Switch back to Mandelbrot view after successful save
+		m.view = MandelbrotView
+		m.saveModel = initSaveModel(m.params) // Reset form
+	}
+	return m, nil
+}
+
 func (m Model) ViewSave() string {
 	var b strings.Builder
 	b.WriteString(docStyle.Render(m.saveModel.form.View()))
+	if s := m.saveModel.save; s.active {
+		b.WriteString(fmt.Sprintf("\n%s%s %s",
+			m.saveModel.spinner.View(),
+			progressStyle.Render(progressBar(s.done, s.total)),
+			valueStyle.Render(fmt.Sprintf("saving %s, %v (esc to cancel)", s.file, time.Since(s.started).Round(100*time.Millisecond)))))
+	}
 	if m.saveModel.errorMsg != "" {
 		b.WriteString("\n" + errorStyle.Render("Error: "+m.saveModel.errorMsg))
 	}
@@ -202,7 +308,7 @@ func (m Model) ViewSave() string {
 func SaveImage(imgByte []byte, filepath string) error {
 	img, _, err := image.Decode(bytes.NewReader(imgByte))
 	if err != nil {
-		log.Fatalln(err)
+		return err
 	}
 	f, err := os.Create(filepath)
 	if err != nil {
@@ -4,6 +4,7 @@ import (
 	"mandel-cli/mandelbrot"
 	"slices"
 
+	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
 )
 
@@ -13,6 +14,7 @@ const (
 	MandelbrotView View = iota
 	PresetsView
 	SaveView
+	FormulaView
 )
 
 type KeyAction string
@@ -24,16 +26,32 @@ type Model struct {
 	mandelbortModel MandelbrotModel
 	presetsModel    PresetsModel
 	saveModel       SaveModel
+	formulaModel    FormulaModel
 	view            View
 }
 
 func InitModel() Model {
-	return Model{
+	m := Model{
 		params:          mandelbrot.InitialMandelbrotParams(),
 		mandelbortModel: initMandelbrotModel(),
-		presetsModel:    initPresetsModel(),
+		formulaModel:    initFormulaModel(),
 		view:            MandelbrotView,
 	}
+	// User palettes come first so presets can use them
+	if err := loadUserPalettes(); err != nil {
+		m.mandelbortModel.errorMsg = err.Error()
+	}
+	m.presetsModel = initPresetsModel()
+	return m
+}
+
+// loadUserPalettes registers the palettes in the user config directory.
+func loadUserPalettes() error {
+	dir, err := mandelbrot.PaletteDir()
+	if err != nil {
+		return err
+	}
+	return mandelbrot.LoadPalettes(dir)
 }
 
 func (m Model) Init() tea.Cmd {
@@ -48,18 +66,21 @@ func (m *Model) Reset() {
 	m.params.Width = currentWidth
 	m.params.Height = currentHeight
 	m.mandelbortModel.errorMsg = ""
+	m.mandelbortModel.parentView = nil
 }
 
-func (m *Model) RedrawMandelbrot() {
-	if !m.mandelbortModel.displayImg && m.mandelbortModel.paramsChanged {
-		m.mandelbortModel.text = mandelbrot.BufferToString(mandelbrot.GenerateMandelbrotText(m.params))
-		m.mandelbortModel.paramsChanged = false
-	} else if m.mandelbortModel.displayImg && m.mandelbortModel.paramsChanged {
-		m.toggleDisplayImg()
-		m.toggleDisplayImg()
-		m.mandelbortModel.paramsChanged = false
-
+// RedrawMandelbrot starts a background render if the params changed, and a
+// new Julia preview if the point under the cursor changed.
+func (m *Model) RedrawMandelbrot() tea.Cmd {
+	var preview tea.Cmd
+	if p := m.mandelbortModel.preview; p.enabled && (p.changed || m.mandelbortModel.paramsChanged) {
+		preview = m.startPreview()
+	}
+	if !m.mandelbortModel.paramsChanged {
+		return preview
 	}
+	m.mandelbortModel.paramsChanged = false
+	return tea.Batch(m.startRender(), preview)
 }
 
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -69,15 +90,30 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 	}
 
+	switch msg := msg.(type) {
+	case renderProgressMsg, renderFrameMsg, renderDoneMsg:
+		return m.updateRender(msg)
+	case saveProgressMsg, saveDoneMsg:
+		return m.updateSaving(msg)
+	case previewMsg:
+		return m.updatePreview(msg)
+	case spinner.TickMsg:
+		// Each spinner only takes its own ticks
+		var render, save tea.Cmd
+		if m.mandelbortModel.render.active {
+			m.mandelbortModel.spinner, render = m.mandelbortModel.spinner.Update(msg)
+		}
+		if m.saveModel.save.active {
+			m.saveModel.spinner, save = m.saveModel.spinner.Update(msg)
+		}
+		return m, tea.Batch(render, save)
+	}
+
 	if msg, ok := msg.(tea.WindowSizeMsg); ok {
 		m.width = msg.Width
 		m.height = msg.Height
-		if m.mandelbortModel.hideMenu {
-			m.params.Width = m.width / 2
-		} else {
-			m.params.Width = (m.width-defaultUIConfig.MenuWidth)/2 - WidthAdjustment
-		}
-		m.params.Height = m.height
+		m.resizeFrame()
+		m.moveCursor(0, 0) // Keep the cursor inside the frame
 		m.mandelbortModel.paramsChanged = true
 	}
 
@@ -87,6 +123,8 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m.UpdatePresets(msg)
 	} else if m.view == SaveView {
 		return m.UpdateSave(msg)
+	} else if m.view == FormulaView {
+		return m.UpdateFormula(msg)
 	}
 	return m, nil
 }
@@ -98,6 +136,8 @@ func (m Model) View() string {
 		return m.ViewPresets()
 	} else if m.view == SaveView {
 		return m.ViewSave()
+	} else if m.view == FormulaView {
+		return m.ViewFormula()
 	}
 	return ""
 }
@@ -1,6 +1,7 @@
 package tui
 
 import (
+	"math"
 	"strings"
 
 	"github.com/charmbracelet/lipgloss"
@@ -9,6 +10,12 @@ import (
 // Constants for UI and Mandelbrot parameters
 const (
 	MoveStep        = 0.1
+	PaletteStep     = 0.05
+	DensityStep     = 1.25
+	ExponentStep    = 0.25
+	RotateStep      = math.Pi / 24
+	LightStep       = math.Pi / 12
+	LightHeightStep = 1.25
 	WidthAdjustment = 2
 	MenuPadding     = 3
 )
@@ -73,6 +80,7 @@ var (
 	errorStyle = lipgloss.NewStyle().
 			Foreground(defaultUIConfig.ErrorColor)
 	selectedStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0"))
+	progressStyle = lipgloss.NewStyle().Foreground(defaultUIConfig.BorderColor)
 )
 
 // styleControlLine styles a single control help line.